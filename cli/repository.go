@@ -10,6 +10,9 @@ import (
 	"strings"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/kbst/kbst/pkg/export"
 	"github.com/kbst/kbst/pkg/stack"
 	"github.com/kbst/kbst/pkg/tfhcl"
@@ -21,6 +24,10 @@ type Repo struct {
 	Catalog    map[string]util.Entry
 	Framework  util.Entry
 	Downloader util.Downloader
+
+	// Channel restricts the versions considered
+	// for clusters added to new repositories
+	Channel string
 }
 
 func (r Repo) Init(starter string, baseDomain string, namePrefix string, region string, envNames []string, baseCfg map[string]cty.Value, release string, gitRef string, path string) (err error) {
@@ -38,7 +45,7 @@ func (r Repo) Init(starter string, baseDomain string, namePrefix string, region
 		})
 	}
 
-	cj := util.CliJSON{}
+	cj := util.CliJSON{Channel: r.Channel}
 	err = cj.Load(util.CachedDownloader{})
 	if err != nil {
 		log.Fatal(err)
@@ -71,11 +78,11 @@ func (r Repo) Init(starter string, baseDomain string, namePrefix string, region
 
 	switch starter {
 	case "aks":
-		_, err = s.AddCluster(namePrefix, "azurerm", region, "", stack.GenerateConfigurations(s.Environments, baseCfg))
+		_, err = s.AddCluster(namePrefix, "azurerm", region, release, stack.GenerateConfigurations(s.Environments, baseCfg))
 	case "eks":
-		_, err = s.AddCluster(namePrefix, "aws", region, "", stack.GenerateConfigurations(s.Environments, baseCfg))
+		_, err = s.AddCluster(namePrefix, "aws", region, release, stack.GenerateConfigurations(s.Environments, baseCfg))
 	case "gke":
-		_, err = s.AddCluster(namePrefix, "google", region, "", stack.GenerateConfigurations(s.Environments, baseCfg))
+		_, err = s.AddCluster(namePrefix, "google", region, release, stack.GenerateConfigurations(s.Environments, baseCfg))
 	default:
 		return fmt.Errorf("unexpected error: starter: '%s' exists as archive, but is not implemented in CLI", starter)
 	}
@@ -98,19 +105,17 @@ func (r Repo) Init(starter string, baseDomain string, namePrefix string, region
 }
 
 func (r Repo) Import(es export.Stack, path string) (err error) {
-	cj := util.CliJSON{}
+	cj := util.CliJSON{Channel: r.Channel}
 	err = cj.Load(util.CachedDownloader{})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	providerToStarter := map[string]string{
-		"aws":     "eks",
-		"azurerm": "aks",
-		"google":  "gke",
+	if len(es.Clusters) == 0 {
+		return fmt.Errorf("nothing to import, no clusters defined")
 	}
 
-	filenames, err := r.extractArchive(providerToStarter[es.Clusters[0].Provider], es.Clusters[0].Version, "", path)
+	filenames, err := r.extractArchive(importStarter(es), es.Clusters[0].Version, "", path)
 	if err != nil {
 		return err
 	}
@@ -151,7 +156,13 @@ func (r Repo) Import(es export.Stack, path string) (err error) {
 	}
 
 	for _, svc := range es.Services {
-		_, err = s.AddService(svc.ClusterName, svc.EntryName, svc.Version)
+		// services exported without configurations get the defaults
+		var cfgs []stack.Configuration
+		if len(svc.Configurations) > 0 {
+			cfgs = es.StackConfigurations(svc.Configurations)
+		}
+
+		_, err = s.AddService(svc.ClusterName, svc.EntryName, svc.Version, cfgs)
 		if err != nil {
 			return err
 		}
@@ -171,6 +182,24 @@ func (r Repo) Import(es export.Stack, path string) (err error) {
 	return
 }
 
+// importStarter returns the starter of the clusters' provider,
+// or the multi-cloud starter if clusters use different providers
+func importStarter(es export.Stack) string {
+	providerToStarter := map[string]string{
+		"aws":     "eks",
+		"azurerm": "aks",
+		"google":  "gke",
+	}
+
+	for _, c := range es.Clusters {
+		if c.Provider != es.Clusters[0].Provider {
+			return "multi-cloud"
+		}
+	}
+
+	return providerToStarter[es.Clusters[0].Provider]
+}
+
 func (r Repo) downloadUrl(starter string, release string, gitRef string) (url string, err error) {
 	if gitRef != "" {
 		return fmt.Sprintf(
@@ -274,3 +303,187 @@ func (r Repo) gitCommit(p string, msg string) error {
 
 	return nil
 }
+
+// Commit stages files and commits them with msg,
+// if branch is set, it is checked out first and
+// created from HEAD if it does not exist yet
+func (r Repo) Commit(p string, files []string, msg string, branch string) error {
+	repo, err := git.PlainOpenWithOptions(p, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	if branch != "" {
+		err = r.gitCheckoutBranch(repo, wt, branch)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		af, err := filepath.Abs(f)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(wt.Filesystem.Root(), af)
+		if err != nil {
+			return err
+		}
+
+		_, err = wt.Add(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = wt.Commit(msg, &git.CommitOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r Repo) gitCheckoutBranch(repo *git.Repository, wt *git.Worktree, branch string) error {
+	ref := plumbing.NewBranchReferenceName(branch)
+
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	if head.Name() == ref {
+		return nil
+	}
+
+	_, err = repo.Reference(ref, false)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	// keep the changes in the worktree
+	// to commit them to the branch
+	return wt.Checkout(&git.CheckoutOptions{
+		Branch: ref,
+		Create: err == plumbing.ErrReferenceNotFound,
+		Keep:   true,
+	})
+}
+
+// UncommittedFiles returns the files that have changes not
+// committed to git, relative to the root of the worktree
+func (r Repo) UncommittedFiles(p string, files []string) (dirty []string, err error) {
+	repo, err := git.PlainOpenWithOptions(p, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return dirty, err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return dirty, err
+	}
+
+	st, err := wt.Status()
+	if err != nil {
+		return dirty, err
+	}
+
+	for _, f := range files {
+		af, err := filepath.Abs(f)
+		if err != nil {
+			return dirty, err
+		}
+
+		rel, err := filepath.Rel(wt.Filesystem.Root(), af)
+		if err != nil {
+			return dirty, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		fst, ok := st[rel]
+		if !ok {
+			continue
+		}
+
+		if fst.Worktree != git.Unmodified || fst.Staging != git.Unmodified {
+			dirty = append(dirty, rel)
+		}
+	}
+
+	sort.Strings(dirty)
+
+	return dirty, nil
+}
+
+// RevisionFS returns the files below p, as they were at the git
+// revision rev, as an in-memory FS, the repository is found from p
+func (r Repo) RevisionFS(p string, rev string) (*tfhcl.MemFS, error) {
+	repo, err := git.PlainOpenWithOptions(p, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	ap, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(wt.Filesystem.Root(), ap)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("revision %q: %s", rev, err)
+	}
+
+	c, err := repo.CommitObject(*h)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	if rel != "." {
+		tree, err = tree.Tree(filepath.ToSlash(rel))
+		if err != nil {
+			return nil, fmt.Errorf("%q does not exist at revision %q", rel, rev)
+		}
+	}
+
+	files := map[string][]byte{}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if f.Mode != filemode.Regular && f.Mode != filemode.Executable {
+			return nil
+		}
+
+		contents, err := f.Contents()
+		if err != nil {
+			return err
+		}
+
+		files[f.Name] = []byte(contents)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tfhcl.NewMemFS(files), nil
+}
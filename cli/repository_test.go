@@ -1,8 +1,11 @@
 package cli
 
 import (
+	"archive/zip"
 	"bytes"
+	"encoding/json"
 	"errors"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -10,9 +13,14 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/kbst/kbst/pkg/export"
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/tfhcl"
 	"github.com/kbst/kbst/pkg/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
 )
 
 type MockDownloaderCliJson struct{}
@@ -212,3 +220,572 @@ func TestRepoDownloadUrlGitRef(t *testing.T) {
 	assert.Equal(t, "https://storage.googleapis.com/dev.quickstart.kubestack.com/kubestack-starter-test-test.zip", url, nil)
 	assert.Equal(t, nil, err, nil)
 }
+
+func TestRepoCommitBranch(t *testing.T) {
+	p, _ := ioutil.TempDir(os.TempDir(), "kbst-unit-test-*")
+	defer os.RemoveAll(p)
+
+	ioutil.WriteFile(filepath.Join(p, "changed.tf"), []byte("# a\n"), 0644)
+	ioutil.WriteFile(filepath.Join(p, "deleted.tf"), []byte("# deleted\n"), 0644)
+	ioutil.WriteFile(filepath.Join(p, "untouched.tf"), []byte("# untouched\n"), 0644)
+
+	r := Repo{}
+	err := r.gitCommit(p, "initial")
+	assert.Equal(t, nil, err, nil)
+
+	ioutil.WriteFile(filepath.Join(p, "changed.tf"), []byte("# b\n"), 0644)
+	ioutil.WriteFile(filepath.Join(p, "created.tf"), []byte("# created\n"), 0644)
+	ioutil.WriteFile(filepath.Join(p, "untouched.tf"), []byte("# local edit\n"), 0644)
+	os.Remove(filepath.Join(p, "deleted.tf"))
+
+	files := []string{
+		filepath.Join(p, "changed.tf"),
+		filepath.Join(p, "created.tf"),
+		filepath.Join(p, "deleted.tf"),
+	}
+	err = r.Commit(p, files, "Add test", "feature")
+	assert.Equal(t, nil, err, nil)
+
+	repo, err := git.PlainOpen(p)
+	assert.Equal(t, nil, err, nil)
+
+	head, err := repo.Head()
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, "refs/heads/feature", head.Name().String(), nil)
+
+	c, err := repo.CommitObject(head.Hash())
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, "Add test", c.Message, nil)
+
+	wt, _ := repo.Worktree()
+	st, err := wt.Status()
+	assert.Equal(t, nil, err, nil)
+
+	// only files passed to commit are committed
+	assert.Len(t, st, 1, nil)
+	assert.Equal(t, git.Modified, st.File("untouched.tf").Worktree, nil)
+}
+
+func TestRepoUncommittedFiles(t *testing.T) {
+	p, _ := ioutil.TempDir(os.TempDir(), "kbst-unit-test-*")
+	defer os.RemoveAll(p)
+
+	ioutil.WriteFile(filepath.Join(p, "clean.tf"), []byte("# clean\n"), 0644)
+	ioutil.WriteFile(filepath.Join(p, "edited.tf"), []byte("# a\n"), 0644)
+
+	r := Repo{}
+	err := r.gitCommit(p, "initial")
+	assert.Equal(t, nil, err, nil)
+
+	ioutil.WriteFile(filepath.Join(p, "edited.tf"), []byte("# b\n"), 0644)
+	ioutil.WriteFile(filepath.Join(p, "untracked.tf"), []byte("# untracked\n"), 0644)
+
+	files := []string{
+		filepath.Join(p, "clean.tf"),
+		filepath.Join(p, "edited.tf"),
+		filepath.Join(p, "untracked.tf"),
+		filepath.Join(p, "new.tf"),
+	}
+	dirty, err := r.UncommittedFiles(p, files)
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []string{"edited.tf", "untracked.tf"}, dirty, nil)
+}
+
+func TestRepoExportImportRoundTrip(t *testing.T) {
+	cj := util.CliJSON{}
+	cj.Load(MockDownloaderCliJson{})
+	r := Repo{
+		Framework:  cj.Framework,
+		Downloader: MockDownloaderFrameworkArchive{},
+	}
+
+	baseCfg := map[string]cty.Value{
+		"name_prefix":                cty.StringVal("test"),
+		"project_id":                 cty.StringVal("kubestack-testing"),
+		"region":                     cty.StringVal("europe-west4"),
+		"cluster_min_node_count":     cty.NumberIntVal(1),
+		"cluster_initial_node_count": cty.NumberIntVal(1),
+		"cluster_max_node_count":     cty.NumberIntVal(3),
+		"cluster_node_locations":     cty.StringVal("europe-west4-a,europe-west4-b,europe-west4-c"),
+		"cluster_machine_type":       cty.StringVal("e2-standard-8"),
+	}
+
+	p, _ := ioutil.TempDir(os.TempDir(), "kbst-unit-test-*")
+	defer os.RemoveAll(p)
+
+	err := r.Init("gke", "kubestack.example.com", "test", "europe-west4", []string{"apps", "ops"}, baseCfg, "v0.18.0-beta.0", "", p)
+	assert.Equal(t, nil, err, nil)
+
+	exportRepo := func(rp string) []byte {
+		scj := util.CliJSON{}
+		err := scj.Load(util.CachedDownloader{})
+		assert.Equal(t, nil, err, nil)
+
+		s := stack.NewStack(tfhcl.NewRoot(rp), scj)
+		err = s.FromPath()
+		assert.Equal(t, nil, err, nil)
+
+		data, err := export.Marshal(export.FromStack(s), "json")
+		assert.Equal(t, nil, err, nil)
+
+		return data
+	}
+
+	// add a node pool and a service to the initialized repository
+	fp := filepath.Join(p, "kubestack-starter-gke")
+	scj := util.CliJSON{}
+	err = scj.Load(util.CachedDownloader{})
+	assert.Equal(t, nil, err, nil)
+
+	s := stack.NewStack(tfhcl.NewRoot(fp), scj)
+	err = s.FromPath()
+	assert.Equal(t, nil, err, nil)
+
+	npCfg := map[string]cty.Value{
+		"name":           cty.StringVal("extra"),
+		"machine_type":   cty.StringVal("e2-standard-8"),
+		"min_node_count": cty.NumberIntVal(1),
+		"max_node_count": cty.NumberIntVal(3),
+	}
+	_, err = s.AddNodePool("gke_test_europe-west4", "extra", stack.GenerateConfigurations(s.Environments, npCfg))
+	assert.Equal(t, nil, err, nil)
+
+	_, err = s.AddService("gke_test_europe-west4", "nginx", "latest", nil)
+	assert.Equal(t, nil, err, nil)
+
+	first := exportRepo(fp)
+
+	es := export.Stack{}
+	err = json.Unmarshal(first, &es)
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, es.Clusters, 1, nil)
+	assert.Len(t, es.NodePools, 1, nil)
+	assert.Len(t, es.Services, 1, nil)
+
+	// generated references are not exported
+	assert.NotContains(t, es.Clusters[0].Configurations[0].Attributes, "base_domain", nil)
+	assert.NotContains(t, es.NodePools[0].Configurations[0].Attributes, "project_id", nil)
+
+	ip, _ := ioutil.TempDir(os.TempDir(), "kbst-unit-test-*")
+	defer os.RemoveAll(ip)
+
+	err = r.Import(es, ip)
+	assert.Equal(t, nil, err, nil)
+
+	second := exportRepo(filepath.Join(ip, "kubestack-starter-gke"))
+	assert.Equal(t, string(first), string(second), nil)
+}
+
+func TestRepoImportMerge(t *testing.T) {
+	cj := util.CliJSON{}
+	cj.Load(MockDownloaderCliJson{})
+	r := Repo{
+		Framework:  cj.Framework,
+		Downloader: MockDownloaderFrameworkArchive{},
+	}
+
+	baseCfg := map[string]cty.Value{
+		"name_prefix":                cty.StringVal("test"),
+		"project_id":                 cty.StringVal("kubestack-testing"),
+		"region":                     cty.StringVal("europe-west4"),
+		"cluster_min_node_count":     cty.NumberIntVal(1),
+		"cluster_initial_node_count": cty.NumberIntVal(1),
+		"cluster_max_node_count":     cty.NumberIntVal(3),
+		"cluster_node_locations":     cty.StringVal("europe-west4-a,europe-west4-b,europe-west4-c"),
+		"cluster_machine_type":       cty.StringVal("e2-standard-8"),
+	}
+
+	p, _ := ioutil.TempDir(os.TempDir(), "kbst-unit-test-*")
+	defer os.RemoveAll(p)
+
+	err := r.Init("gke", "kubestack.example.com", "test", "europe-west4", []string{"apps", "ops"}, baseCfg, "v0.18.0-beta.0", "", p)
+	assert.Equal(t, nil, err, nil)
+
+	fp := filepath.Join(p, "kubestack-starter-gke")
+	scj := util.CliJSON{}
+	err = scj.Load(util.CachedDownloader{})
+	assert.Equal(t, nil, err, nil)
+
+	load := func() *stack.Stack {
+		s := stack.NewStack(tfhcl.NewRoot(fp), scj)
+		err := s.FromPath()
+		assert.Equal(t, nil, err, nil)
+		return s
+	}
+
+	before := export.FromStack(load())
+
+	// the import changes the cluster and adds a node pool and a service
+	es, err := export.Unmarshal([]byte(`
+base_domain: kubestack.example.com
+environments:
+  - key: apps
+    is_base_key: true
+  - key: ops
+clusters:
+  - name_prefix: test
+    provider: google
+    region: europe-west4
+    version: v0.18.0-beta.0
+    configurations:
+      - environment_key: apps
+        attributes:
+          cluster_initial_node_count: 1
+          cluster_machine_type: e2-standard-8
+          cluster_max_node_count: 5
+          cluster_min_node_count: 1
+          cluster_node_locations: europe-west4-a,europe-west4-b,europe-west4-c
+          name_prefix: test
+          project_id: kubestack-testing
+          region: europe-west4
+      - environment_key: ops
+        attributes: {}
+node_pools:
+  - pool_name: extra
+    cluster_name: gke_test_europe-west4
+    provider: google
+    region: europe-west4
+    version: v0.18.0-beta.0
+    configurations:
+      - environment_key: apps
+        attributes:
+          machine_type: e2-standard-8
+          max_node_count: 3
+          min_node_count: 1
+          name: extra
+      - environment_key: ops
+        attributes: {}
+services:
+  - entry_name: nginx
+    cluster_name: gke_test_europe-west4
+    provider: kustomization
+    version: 0.49.3-kbst.0
+    configurations:
+      - environment_key: apps
+        attributes:
+          variant: custom
+      - environment_key: ops
+        attributes: {}
+`))
+	assert.Equal(t, nil, err, nil)
+
+	// fail changes nothing
+	changes, err := export.Merge(load(), es, "fail")
+	assert.EqualError(t, err, `modules already exist: ["gke_test_europe-west4"]`, nil)
+	assert.Equal(t, "conflict", changes[0].Action, nil)
+	assert.Equal(t, before, export.FromStack(load()), nil)
+
+	// skip keeps the cluster
+	changes, err = export.Merge(load(), es, "skip")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []string{"skip", "add", "add"}, []string{changes[0].Action, changes[1].Action, changes[2].Action}, nil)
+
+	skipped := export.FromStack(load())
+	assert.Equal(t, before.Clusters, skipped.Clusters, nil)
+	assert.Equal(t, es.NodePools, skipped.NodePools, nil)
+	assert.Equal(t, es.Services, skipped.Services, nil)
+
+	// overwrite replaces the cluster, node pool and service
+	changes, err = export.Merge(load(), es, "overwrite")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []string{"overwrite", "overwrite", "overwrite"}, []string{changes[0].Action, changes[1].Action, changes[2].Action}, nil)
+
+	expected, err := export.Marshal(es, "json")
+	assert.Equal(t, nil, err, nil)
+
+	actual, err := export.Marshal(export.FromStack(load()), "json")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, string(expected), string(actual), nil)
+
+	// environments can not be added
+	es.Environments = append(es.Environments, export.Environment{Key: "loc"})
+	_, err = export.Merge(load(), es, "skip")
+	assert.EqualError(t, err, `environment "loc" does not match the environments of the repository`, nil)
+}
+
+func TestRepoApply(t *testing.T) {
+	cj := util.CliJSON{}
+	cj.Load(MockDownloaderCliJson{})
+	r := Repo{
+		Framework:  cj.Framework,
+		Downloader: MockDownloaderFrameworkArchive{},
+	}
+
+	baseCfg := map[string]cty.Value{
+		"name_prefix":                cty.StringVal("test"),
+		"project_id":                 cty.StringVal("kubestack-testing"),
+		"region":                     cty.StringVal("europe-west4"),
+		"cluster_min_node_count":     cty.NumberIntVal(1),
+		"cluster_initial_node_count": cty.NumberIntVal(1),
+		"cluster_max_node_count":     cty.NumberIntVal(3),
+		"cluster_node_locations":     cty.StringVal("europe-west4-a,europe-west4-b,europe-west4-c"),
+		"cluster_machine_type":       cty.StringVal("e2-standard-8"),
+	}
+
+	p, _ := ioutil.TempDir(os.TempDir(), "kbst-unit-test-*")
+	defer os.RemoveAll(p)
+
+	err := r.Init("gke", "kubestack.example.com", "test", "europe-west4", []string{"apps", "ops"}, baseCfg, "v0.18.0-beta.0", "", p)
+	assert.Equal(t, nil, err, nil)
+
+	fp := filepath.Join(p, "kubestack-starter-gke")
+	scj := util.CliJSON{}
+	err = scj.Load(util.CachedDownloader{})
+	assert.Equal(t, nil, err, nil)
+
+	load := func() *stack.Stack {
+		s := stack.NewStack(tfhcl.NewRoot(fp), scj)
+		err := s.FromPath()
+		assert.Equal(t, nil, err, nil)
+		return s
+	}
+
+	actions := func(changes []export.Change) (a []string) {
+		for _, ch := range changes {
+			a = append(a, ch.Action+" "+ch.Name)
+		}
+		return a
+	}
+
+	es := export.FromStack(load())
+
+	// the unchanged repository is the desired state
+	changes, err := export.Plan(load(), es, true)
+	assert.Equal(t, nil, err, nil)
+	assert.Empty(t, changes, nil)
+
+	// declare a node pool and a service
+	es.NodePools = []export.NodePool{{
+		PoolName:    "extra",
+		ClusterName: "gke_test_europe-west4",
+		Configurations: []export.Configuration{
+			{EnvironmentKey: "apps", Attributes: map[string]ctyJson.SimpleJSONValue{
+				"name":           {Value: cty.StringVal("extra")},
+				"machine_type":   {Value: cty.StringVal("e2-standard-8")},
+				"min_node_count": {Value: cty.NumberIntVal(1)},
+				"max_node_count": {Value: cty.NumberIntVal(3)},
+			}},
+			{EnvironmentKey: "ops", Attributes: map[string]ctyJson.SimpleJSONValue{}},
+		},
+	}}
+	es.Services = []export.Service{{
+		EntryName:   "nginx",
+		ClusterName: "gke_test_europe-west4",
+		Version:     "~> 0.49.0",
+	}}
+
+	s := load()
+	changes, err = export.Plan(s, es, true)
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []string{"add gke_test_europe-west4_node_pool_extra", "add gke_test_europe-west4_service_nginx"}, actions(changes), nil)
+
+	err = export.Apply(s, changes)
+	assert.Equal(t, nil, err, nil)
+
+	// applying again changes nothing, the version satisfies the constraint
+	changes, err = export.Plan(load(), es, true)
+	assert.Equal(t, nil, err, nil)
+	assert.Empty(t, changes, nil)
+
+	// change the cluster and drop the service
+	es.Clusters[0].Configurations[0].Attributes["cluster_max_node_count"] = ctyJson.SimpleJSONValue{Value: cty.NumberIntVal(5)}
+	es.Services = []export.Service{}
+
+	changes, err = export.Plan(load(), es, false)
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []string{"update gke_test_europe-west4"}, actions(changes), nil)
+
+	s = load()
+	changes, err = export.Plan(s, es, true)
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []string{"update gke_test_europe-west4", "remove gke_test_europe-west4_service_nginx"}, actions(changes), nil)
+
+	err = export.Apply(s, changes)
+	assert.Equal(t, nil, err, nil)
+
+	after := export.FromStack(load())
+	assert.Equal(t, "5", after.Clusters[0].Configurations[0].Attributes["cluster_max_node_count"].Value.AsBigFloat().String(), nil)
+	assert.Len(t, after.NodePools, 1, nil)
+	assert.Empty(t, after.Services, nil)
+}
+
+func TestRepoRevisionFS(t *testing.T) {
+	cj := util.CliJSON{}
+	cj.Load(MockDownloaderCliJson{})
+	r := Repo{
+		Framework:  cj.Framework,
+		Downloader: MockDownloaderFrameworkArchive{},
+	}
+
+	baseCfg := map[string]cty.Value{
+		"name_prefix":                cty.StringVal("test"),
+		"cluster_availability_zones": cty.StringVal("eu-west-1a,eu-west-1b,eu-west-1c"),
+		"cluster_instance_type":      cty.StringVal("m5a.2xlarge"),
+		"cluster_min_size":           cty.NumberIntVal(3),
+		"cluster_desired_capacity":   cty.NumberIntVal(3),
+		"cluster_max_size":           cty.NumberIntVal(9),
+	}
+
+	p, _ := ioutil.TempDir(os.TempDir(), "kbst-unit-test-*")
+	defer os.RemoveAll(p)
+
+	err := r.Init("eks", "kubestack.example.com", "test", "eu-west-1", []string{"apps", "ops"}, baseCfg, "v0.18.0-beta.0", "", p)
+	assert.Equal(t, nil, err, nil)
+
+	fp := filepath.Join(p, "kubestack-starter-eks")
+	scj := util.CliJSON{}
+	err = scj.Load(util.CachedDownloader{})
+	assert.Equal(t, nil, err, nil)
+
+	// change the working tree after the initial commit
+	s := stack.NewStack(tfhcl.NewRoot(fp), scj)
+	err = s.FromPath()
+	assert.Equal(t, nil, err, nil)
+
+	_, err = s.AddService(s.Clusters()[0].Name(), "nginx", "0.49.3-kbst.0", nil)
+	assert.Equal(t, nil, err, nil)
+
+	rfs, err := r.RevisionFS(fp, "HEAD")
+	assert.Equal(t, nil, err, nil)
+
+	from := stack.NewStack(tfhcl.NewRootFS(fp, rfs), scj)
+	err = from.FromPath()
+	assert.Equal(t, nil, err, nil)
+
+	to := stack.NewStack(tfhcl.NewRoot(fp), scj)
+	err = to.FromPath()
+	assert.Equal(t, nil, err, nil)
+
+	diffs := export.Diff(export.FromStack(from), export.FromStack(to))
+	assert.Equal(t, []export.ModuleDiff{{
+		Type:      "service",
+		Name:      s.Clusters()[0].Name() + "_service_nginx",
+		Change:    "added",
+		ToVersion: "0.49.3-kbst.0",
+	}}, diffs, nil)
+
+	_, err = r.RevisionFS(fp, "no-such-rev")
+	assert.EqualError(t, err, `revision "no-such-rev": reference not found`, nil)
+}
+
+// MockDownloaderStarterDir serves starter archives of any version
+// zipped from the test_fixtures directory of the starter, or the
+// v0.18.0-beta.0 archive for starters without a directory
+type MockDownloaderStarterDir struct{}
+
+func (c MockDownloaderStarterDir) Download(url string) (resp *http.Response, err error) {
+	fn := strings.Split(url, "/")[4]
+	starter := strings.Split(strings.TrimPrefix(fn, "kubestack-starter-"), "-v")[0]
+	dir := filepath.Join(fixturesPath, starter)
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		f, err := os.Open(filepath.Join(fixturesPath, "kubestack-starter-"+starter+"-v0.18.0-beta.0.zip"))
+		if err != nil {
+			return resp, err
+		}
+
+		return &http.Response{Body: f}, nil
+	}
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join("kubestack-starter-"+starter, rel))
+
+		if d.IsDir() {
+			_, err = zw.Create(name + "/")
+			return err
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return resp, err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return resp, err
+	}
+
+	r := &http.Response{
+		Body: ioutil.NopCloser(bytes.NewReader(b.Bytes())),
+	}
+	return r, nil
+}
+
+func TestRepoImportGeneratorRoundTrip(t *testing.T) {
+	cj := util.CliJSON{}
+	err := cj.Load(util.CachedDownloader{})
+	assert.Equal(t, nil, err, nil)
+
+	r := Repo{
+		Framework:  cj.Framework,
+		Downloader: MockDownloaderStarterDir{},
+	}
+
+	cases := map[string]string{
+		"single_eks.json":  "eks",
+		"single_aks.json":  "aks",
+		"single_gke.json":  "gke",
+		"multi_cloud.json": "multi-cloud",
+	}
+
+	for fixture, starter := range cases {
+		t.Run(fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join(fixturesPath, "generator", fixture))
+			assert.Equal(t, nil, err, nil)
+
+			es, err := export.Unmarshal(data)
+			assert.Equal(t, nil, err, nil)
+			assert.Equal(t, starter, importStarter(es), nil)
+
+			// services keep their configurations
+			es.Services[0].Configurations[0].Attributes["variant"] = ctyJson.SimpleJSONValue{Value: cty.StringVal("custom")}
+
+			expected, err := export.Marshal(es, "json")
+			assert.Equal(t, nil, err, nil)
+
+			p, _ := ioutil.TempDir(os.TempDir(), "kbst-unit-test-*")
+			defer os.RemoveAll(p)
+
+			err = r.Import(es, p)
+			assert.Equal(t, nil, err, nil)
+
+			rp := filepath.Join(p, "kubestack-starter-"+starter)
+			s := stack.NewStack(tfhcl.NewRoot(rp), cj)
+			err = s.FromPath()
+			assert.Equal(t, nil, err, nil)
+
+			actual, err := export.Marshal(export.FromStack(s), "json")
+			assert.Equal(t, nil, err, nil)
+			assert.Equal(t, string(expected), string(actual), nil)
+
+			df, err := os.ReadFile(filepath.Join(rp, "Dockerfile"))
+			assert.Equal(t, nil, err, nil)
+			if starter == "multi-cloud" {
+				assert.Equal(t, "FROM kubestack/framework:v0.10.0-beta.0\n", string(df), nil)
+			} else {
+				assert.True(t, strings.HasSuffix(string(df), "-"+starter+"\n"), string(df))
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"log"
 	"strings"
 
@@ -68,6 +69,8 @@ var nodePoolGKEDiskType string
 var nodePoolGKEDiskSize int64
 var nodePoolGKEZones string
 
+var clusterRelease string
+
 var serviceRelease string
 var serviceClusterName string
 
@@ -99,35 +102,41 @@ var clusterAddAKSCmd = &cobra.Command{
 		region := args[1]
 		resourceGroup := args[2]
 
-		cj := util.CliJSON{}
+		cj := util.CliJSON{Channel: channel}
 		err := cj.Load(util.CachedDownloader{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		r := tfhcl.NewRoot(path)
-		s := stack.NewStack(r, cj)
-		err = s.FromPath()
-		if err != nil {
-			log.Fatal(err)
-		}
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
 
-		zones := strings.Split(clusterAKSZones, ",")
-		if clusterAKSZones == "" {
-			zones = cj.CloudInfo.Zones("azurerm", region, clusterAKSInstanceType)
-		}
+			zones := strings.Split(clusterAKSZones, ",")
+			if clusterAKSZones == "" {
+				zones = cj.CloudInfo.Zones("azurerm", region, clusterAKSInstanceType)
+			}
 
-		baseCfg := map[string]cty.Value{
-			"name_prefix":                  cty.StringVal(namePrefix),
-			"resource_group":               cty.StringVal(resourceGroup),
-			"default_node_pool_vm_size":    cty.StringVal(clusterAKSInstanceType),
-			"default_node_pool_min_count":  cty.NumberIntVal(clusterAKSMinNodes),
-			"default_node_pool_node_count": cty.NumberIntVal(clusterAKSMinNodes),
-			"default_node_pool_max_count":  cty.NumberIntVal(clusterAKSMaxNodes),
-			"availability_zones":           cty.StringVal(strings.Join(zones, ",")),
-		}
+			baseCfg := map[string]cty.Value{
+				"name_prefix":                  cty.StringVal(namePrefix),
+				"resource_group":               cty.StringVal(resourceGroup),
+				"default_node_pool_vm_size":    cty.StringVal(clusterAKSInstanceType),
+				"default_node_pool_min_count":  cty.NumberIntVal(clusterAKSMinNodes),
+				"default_node_pool_node_count": cty.NumberIntVal(clusterAKSMinNodes),
+				"default_node_pool_max_count":  cty.NumberIntVal(clusterAKSMaxNodes),
+				"availability_zones":           cty.StringVal(strings.Join(zones, ",")),
+			}
+
+			c, err := s.AddCluster(namePrefix, "azurerm", region, clusterRelease, stack.GenerateConfigurations(s.Environments, baseCfg))
+			if err != nil {
+				return "", err
+			}
 
-		_, err = s.AddCluster(namePrefix, "azurerm", region, "", stack.GenerateConfigurations(s.Environments, baseCfg))
+			return fmt.Sprintf("Add cluster %s", c.Name()), nil
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -142,34 +151,40 @@ var clusterAddEKSCmd = &cobra.Command{
 		namePrefix := args[0]
 		region := args[1]
 
-		cj := util.CliJSON{}
+		cj := util.CliJSON{Channel: channel}
 		err := cj.Load(util.CachedDownloader{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		r := tfhcl.NewRoot(path)
-		s := stack.NewStack(r, cj)
-		err = s.FromPath()
-		if err != nil {
-			log.Fatal(err)
-		}
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
 
-		zones := strings.Split(clusterEKSZones, ",")
-		if clusterEKSZones == "" {
-			zones = cj.CloudInfo.Zones("aws", region, clusterEKSInstanceType)
-		}
+			zones := strings.Split(clusterEKSZones, ",")
+			if clusterEKSZones == "" {
+				zones = cj.CloudInfo.Zones("aws", region, clusterEKSInstanceType)
+			}
 
-		baseCfg := map[string]cty.Value{
-			"name_prefix":                cty.StringVal(namePrefix),
-			"cluster_availability_zones": cty.StringVal(strings.Join(zones, ",")),
-			"cluster_instance_type":      cty.StringVal(clusterEKSInstanceType),
-			"cluster_min_size":           cty.NumberIntVal(clusterEKSMinNodes),
-			"cluster_desired_capacity":   cty.NumberIntVal(clusterEKSMinNodes),
-			"cluster_max_size":           cty.NumberIntVal(clusterEKSMaxNodes),
-		}
+			baseCfg := map[string]cty.Value{
+				"name_prefix":                cty.StringVal(namePrefix),
+				"cluster_availability_zones": cty.StringVal(strings.Join(zones, ",")),
+				"cluster_instance_type":      cty.StringVal(clusterEKSInstanceType),
+				"cluster_min_size":           cty.NumberIntVal(clusterEKSMinNodes),
+				"cluster_desired_capacity":   cty.NumberIntVal(clusterEKSMinNodes),
+				"cluster_max_size":           cty.NumberIntVal(clusterEKSMaxNodes),
+			}
+
+			c, err := s.AddCluster(namePrefix, "aws", region, clusterRelease, stack.GenerateConfigurations(s.Environments, baseCfg))
+			if err != nil {
+				return "", err
+			}
 
-		_, err = s.AddCluster(namePrefix, "aws", region, "", stack.GenerateConfigurations(s.Environments, baseCfg))
+			return fmt.Sprintf("Add cluster %s", c.Name()), nil
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -185,37 +200,43 @@ var clusterAddGKECmd = &cobra.Command{
 		region := args[1]
 		projectID := args[2]
 
-		cj := util.CliJSON{}
+		cj := util.CliJSON{Channel: channel}
 		err := cj.Load(util.CachedDownloader{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		r := tfhcl.NewRoot(path)
-		s := stack.NewStack(r, cj)
-		err = s.FromPath()
-		if err != nil {
-			log.Fatal(err)
-		}
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
 
-		zones := strings.Split(clusterGKEZones, ",")
-		if clusterGKEZones == "" {
-			zones = cj.CloudInfo.Zones("google", region, clusterGKEInstanceType)
-		}
+			zones := strings.Split(clusterGKEZones, ",")
+			if clusterGKEZones == "" {
+				zones = cj.CloudInfo.Zones("google", region, clusterGKEInstanceType)
+			}
 
-		baseCfg := map[string]cty.Value{
-			"name_prefix":                cty.StringVal(namePrefix),
-			"project_id":                 cty.StringVal(projectID),
-			"region":                     cty.StringVal(region),
-			"cluster_min_node_count":     cty.NumberIntVal(clusterGKEMinNodes),
-			"cluster_initial_node_count": cty.NumberIntVal(clusterGKEMinNodes),
-			"cluster_max_node_count":     cty.NumberIntVal(clusterGKEMaxNodes),
-			"cluster_node_locations":     cty.StringVal(strings.Join(zones, ",")),
-			"cluster_machine_type":       cty.StringVal(clusterGKEInstanceType),
-			"cluster_min_master_version": cty.StringVal("1.25"),
-		}
+			baseCfg := map[string]cty.Value{
+				"name_prefix":                cty.StringVal(namePrefix),
+				"project_id":                 cty.StringVal(projectID),
+				"region":                     cty.StringVal(region),
+				"cluster_min_node_count":     cty.NumberIntVal(clusterGKEMinNodes),
+				"cluster_initial_node_count": cty.NumberIntVal(clusterGKEMinNodes),
+				"cluster_max_node_count":     cty.NumberIntVal(clusterGKEMaxNodes),
+				"cluster_node_locations":     cty.StringVal(strings.Join(zones, ",")),
+				"cluster_machine_type":       cty.StringVal(clusterGKEInstanceType),
+				"cluster_min_master_version": cty.StringVal("1.25"),
+			}
+
+			c, err := s.AddCluster(namePrefix, "google", region, clusterRelease, stack.GenerateConfigurations(s.Environments, baseCfg))
+			if err != nil {
+				return "", err
+			}
 
-		_, err = s.AddCluster(namePrefix, "google", region, "", stack.GenerateConfigurations(s.Environments, baseCfg))
+			return fmt.Sprintf("Add cluster %s", c.Name()), nil
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -240,36 +261,42 @@ var nodePoolAddAKSCmd = &cobra.Command{
 		clusterName := args[0]
 		poolName := args[1]
 
-		cj := util.CliJSON{}
+		cj := util.CliJSON{Channel: channel}
 		err := cj.Load(util.CachedDownloader{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		r := tfhcl.NewRoot(path)
-		s := stack.NewStack(r, cj)
-		err = s.FromPath()
-		if err != nil {
-			log.Fatal(err)
-		}
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
 
-		baseCfg := map[string]cty.Value{
-			"node_pool_name": cty.StringVal(poolName),
-			"vm_size":        cty.StringVal(nodePoolAKSInstanceType),
-			"node_count ":    cty.NumberIntVal(nodePoolAKSMinNodes),
-			"min_count":      cty.NumberIntVal(nodePoolAKSMinNodes),
-			"max_count":      cty.NumberIntVal(nodePoolAKSMaxNodes),
-		}
+			baseCfg := map[string]cty.Value{
+				"node_pool_name": cty.StringVal(poolName),
+				"vm_size":        cty.StringVal(nodePoolAKSInstanceType),
+				"node_count ":    cty.NumberIntVal(nodePoolAKSMinNodes),
+				"min_count":      cty.NumberIntVal(nodePoolAKSMinNodes),
+				"max_count":      cty.NumberIntVal(nodePoolAKSMaxNodes),
+			}
 
-		if len(nodePoolAKSZones) > 0 {
-			baseCfg["availability_zones "] = cty.StringVal(nodePoolAKSZones)
-		}
+			if len(nodePoolAKSZones) > 0 {
+				baseCfg["availability_zones "] = cty.StringVal(nodePoolAKSZones)
+			}
 
-		if nodePoolAKSDiskSize != 0 {
-			baseCfg["os_disk_size_gb"] = cty.NumberIntVal(nodePoolAKSDiskSize)
-		}
+			if nodePoolAKSDiskSize != 0 {
+				baseCfg["os_disk_size_gb"] = cty.NumberIntVal(nodePoolAKSDiskSize)
+			}
 
-		_, err = s.AddNodePool(clusterName, poolName, stack.GenerateConfigurations(s.Environments, baseCfg))
+			np, err := s.AddNodePool(clusterName, poolName, stack.GenerateConfigurations(s.Environments, baseCfg))
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("Add node pool %s to %s", np.PoolName, np.ClusterName), nil
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -284,40 +311,46 @@ var nodePoolAddEKSCmd = &cobra.Command{
 		clusterName := args[0]
 		poolName := args[1]
 
-		cj := util.CliJSON{}
+		cj := util.CliJSON{Channel: channel}
 		err := cj.Load(util.CachedDownloader{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		r := tfhcl.NewRoot(path)
-		s := stack.NewStack(r, cj)
-		err = s.FromPath()
-		if err != nil {
-			log.Fatal(err)
-		}
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
 
-		baseCfg := map[string]cty.Value{
-			"name":              cty.StringVal(poolName),
-			"instance_types":    cty.StringVal(nodePoolEKSInstanceType),
-			"desired_capacity ": cty.NumberIntVal(nodePoolEKSMinNodes),
-			"min_size":          cty.NumberIntVal(nodePoolEKSMinNodes),
-			"max_size":          cty.NumberIntVal(nodePoolEKSMaxNodes),
-		}
+			baseCfg := map[string]cty.Value{
+				"name":              cty.StringVal(poolName),
+				"instance_types":    cty.StringVal(nodePoolEKSInstanceType),
+				"desired_capacity ": cty.NumberIntVal(nodePoolEKSMinNodes),
+				"min_size":          cty.NumberIntVal(nodePoolEKSMinNodes),
+				"max_size":          cty.NumberIntVal(nodePoolEKSMaxNodes),
+			}
 
-		if len(nodePoolEKSZones) > 0 {
-			baseCfg["availability_zones "] = cty.StringVal(nodePoolEKSZones)
-		}
+			if len(nodePoolEKSZones) > 0 {
+				baseCfg["availability_zones "] = cty.StringVal(nodePoolEKSZones)
+			}
 
-		if nodePoolEKSAMIType != "" {
-			baseCfg["ami_type"] = cty.StringVal(nodePoolEKSAMIType)
-		}
+			if nodePoolEKSAMIType != "" {
+				baseCfg["ami_type"] = cty.StringVal(nodePoolEKSAMIType)
+			}
 
-		if nodePoolEKSDiskSize != 0 {
-			baseCfg["disk_size"] = cty.NumberIntVal(nodePoolEKSDiskSize)
-		}
+			if nodePoolEKSDiskSize != 0 {
+				baseCfg["disk_size"] = cty.NumberIntVal(nodePoolEKSDiskSize)
+			}
+
+			np, err := s.AddNodePool(clusterName, poolName, stack.GenerateConfigurations(s.Environments, baseCfg))
+			if err != nil {
+				return "", err
+			}
 
-		_, err = s.AddNodePool(clusterName, poolName, stack.GenerateConfigurations(s.Environments, baseCfg))
+			return fmt.Sprintf("Add node pool %s to %s", np.PoolName, np.ClusterName), nil
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -332,48 +365,54 @@ var nodePoolAddGKECmd = &cobra.Command{
 		clusterName := args[0]
 		poolName := args[1]
 
-		cj := util.CliJSON{}
+		cj := util.CliJSON{Channel: channel}
 		err := cj.Load(util.CachedDownloader{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		r := tfhcl.NewRoot(path)
-		s := stack.NewStack(r, cj)
-		err = s.FromPath()
-		if err != nil {
-			log.Fatal(err)
-		}
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
 
-		baseCfg := map[string]cty.Value{
-			"name":               cty.StringVal(poolName),
-			"min_node_count":     cty.NumberIntVal(nodePoolGKEMinNodes),
-			"initial_node_count": cty.NumberIntVal(nodePoolGKEMinNodes),
-			"max_node_count":     cty.NumberIntVal(nodePoolGKEMaxNodes),
-			"machine_type":       cty.StringVal(nodePoolGKEInstanceType),
-		}
+			baseCfg := map[string]cty.Value{
+				"name":               cty.StringVal(poolName),
+				"min_node_count":     cty.NumberIntVal(nodePoolGKEMinNodes),
+				"initial_node_count": cty.NumberIntVal(nodePoolGKEMinNodes),
+				"max_node_count":     cty.NumberIntVal(nodePoolGKEMaxNodes),
+				"machine_type":       cty.StringVal(nodePoolGKEInstanceType),
+			}
 
-		var zones []cty.Value
-		if len(nodePoolGKEZones) > 0 {
-			for _, z := range strings.Split(nodePoolGKEZones, ",") {
-				zones = append(zones, cty.StringVal(z))
+			var zones []cty.Value
+			if len(nodePoolGKEZones) > 0 {
+				for _, z := range strings.Split(nodePoolGKEZones, ",") {
+					zones = append(zones, cty.StringVal(z))
+				}
+				baseCfg["node_locations"] = cty.ListVal(zones)
 			}
-			baseCfg["node_locations"] = cty.ListVal(zones)
-		}
 
-		if nodePoolGKEImageType != "" {
-			baseCfg["image_type"] = cty.StringVal(nodePoolGKEImageType)
-		}
+			if nodePoolGKEImageType != "" {
+				baseCfg["image_type"] = cty.StringVal(nodePoolGKEImageType)
+			}
 
-		if nodePoolGKEDiskType != "" {
-			baseCfg["disk_type"] = cty.StringVal(nodePoolGKEDiskType)
-		}
+			if nodePoolGKEDiskType != "" {
+				baseCfg["disk_type"] = cty.StringVal(nodePoolGKEDiskType)
+			}
 
-		if nodePoolGKEDiskSize != 0 {
-			baseCfg["disk_size_gb"] = cty.NumberIntVal(nodePoolGKEDiskSize)
-		}
+			if nodePoolGKEDiskSize != 0 {
+				baseCfg["disk_size_gb"] = cty.NumberIntVal(nodePoolGKEDiskSize)
+			}
+
+			np, err := s.AddNodePool(clusterName, poolName, stack.GenerateConfigurations(s.Environments, baseCfg))
+			if err != nil {
+				return "", err
+			}
 
-		_, err = s.AddNodePool(clusterName, poolName, stack.GenerateConfigurations(s.Environments, baseCfg))
+			return fmt.Sprintf("Add node pool %s to %s", np.PoolName, np.ClusterName), nil
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -388,32 +427,50 @@ var serviceAddCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		entryName := args[0]
 
-		cj := util.CliJSON{}
+		cj := util.CliJSON{Channel: channel}
 		err := cj.Load(util.CachedDownloader{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		r := tfhcl.NewRoot(path)
-		s := stack.NewStack(r, cj)
-		err = s.FromPath()
-		if err != nil {
-			log.Fatal(err)
-		}
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
 
-		clusters := s.Clusters()
+			var clusterNames []string
+			clusters := s.Clusters()
 
-		for _, c := range clusters {
-			currentClusterName := c.Name()
+			// all clusters' services are written at once, if
+			// one fails, the repository is left unchanged
+			err = s.Batch(func() error {
+				for _, c := range clusters {
+					currentClusterName := c.Name()
 
-			if serviceClusterName != "" && serviceClusterName != currentClusterName {
-				continue
-			}
+					if serviceClusterName != "" && serviceClusterName != currentClusterName {
+						continue
+					}
 
-			_, err = s.AddService(currentClusterName, entryName, serviceRelease)
+					_, err := s.AddService(currentClusterName, entryName, serviceRelease, nil)
+					if err != nil {
+						return err
+					}
+
+					clusterNames = append(clusterNames, currentClusterName)
+				}
+
+				return nil
+			})
 			if err != nil {
-				log.Fatal(err)
+				return "", err
 			}
+
+			return fmt.Sprintf("Add service %s to %s", entryName, strings.Join(clusterNames, ", ")), nil
+		})
+		if err != nil {
+			log.Fatal(err)
 		}
 	},
 }
@@ -421,12 +478,15 @@ var serviceAddCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(addCmd)
 
+	addMutationFlags(addCmd)
+
 	sharedFlags.StringVarP(&clusterNamePrefix, "name-prefix", "n", "", "cluster name prefix")
 	sharedFlags.StringVarP(&clusterRegion, "region", "r", "", "cluster region")
 
 	// Clusters
 	addCmd.AddCommand(clusterAddCmd)
 	clusterAddCmd.PersistentFlags().AddFlagSet(&sharedFlags)
+	clusterAddCmd.PersistentFlags().StringVar(&clusterRelease, "release", "latest", "desired framework release version or constraint, e.g. '~> 0.18'")
 
 	clusterAddCmd.AddCommand(clusterAddAKSCmd)
 	clusterAddAKSCmd.Flags().StringVar(&clusterAKSInstanceType, "aks-vm-size", "Standard_D2_v4", "vm size of nodes")
@@ -475,6 +535,6 @@ func init() {
 
 	// Services
 	addCmd.AddCommand(serviceAddCmd)
-	serviceAddCmd.Flags().StringVarP(&serviceRelease, "release", "r", "latest", "desired release version")
+	serviceAddCmd.Flags().StringVarP(&serviceRelease, "release", "r", "latest", "desired release version or constraint, e.g. '~> 1.3'")
 	serviceAddCmd.Flags().StringVarP(&serviceClusterName, "cluster-name", "c", "", "add service to single cluster (default add to all clusters)")
 }
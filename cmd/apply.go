@@ -0,0 +1,114 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/kbst/kbst/pkg/export"
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var applyFile string
+var applyPrune bool
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Reconcile the repository with a desired state file in export format",
+	Long: `Reconcile the repository with a desired state file in export
+format, as JSON or YAML, read from --file or, if --file is -, from stdin.
+
+Missing clusters, node pools and services are added, modules with
+different versions or configurations are updated and, with --prune,
+modules the file does not declare are removed. The plan is printed
+before any change is written, use --dry-run to only print it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := readInput(cmd, applyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		es, err := export.Unmarshal(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cj := util.CliJSON{Channel: channel}
+		err = cj.Load(util.CachedDownloader{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
+
+			changes, err := export.Plan(s, es, applyPrune)
+			if err != nil {
+				return "", err
+			}
+
+			printPlan(cmd, changes)
+			if len(changes) == 0 {
+				return "", nil
+			}
+
+			err = export.Apply(s, changes)
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("Apply %s", applyFile), nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func printPlan(cmd *cobra.Command, changes []export.Change) {
+	out := cmd.OutOrStdout()
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "No changes, the repository matches the desired state.")
+		return
+	}
+
+	counts := map[string]int{}
+	for _, ch := range changes {
+		counts[ch.Action]++
+		fmt.Fprintf(out, "  %s\n", ch)
+	}
+
+	fmt.Fprintf(out, "Plan: %d to add, %d to update, %d to remove.\n", counts["add"], counts["update"], counts["remove"])
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	addMutationFlags(applyCmd)
+
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "desired state file, or - for stdin")
+	applyCmd.Flags().BoolVar(&applyPrune, "prune", false, "remove clusters, node pools and services the file does not declare")
+	applyCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,75 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/kbst/kbst/cli"
+	"github.com/kbst/kbst/pkg/tfhcl"
+)
+
+var autoCommit bool
+var commitBranch string
+var force bool
+
+// commitDefault enables auto-commit if KBST_COMMIT is true
+func commitDefault() bool {
+	v, _ := strconv.ParseBool(os.Getenv("KBST_COMMIT"))
+	return v
+}
+
+// commitChanges commits the files written by r with msg,
+// it does nothing unless --commit or --branch is set
+func commitChanges(r *tfhcl.Root, msg string) error {
+	if dryRun || (!autoCommit && commitBranch == "") {
+		return nil
+	}
+
+	files := r.WrittenFiles()
+	if len(files) == 0 {
+		return nil
+	}
+
+	return cli.Repo{}.Commit(path, files, msg, commitBranch)
+}
+
+// refuseUncommitted returns an error if any of the files in
+// paths has changes not committed to git, because kbst writes
+// them as a whole and local edits would be lost
+func refuseUncommitted(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	dirty, err := cli.Repo{}.UncommittedFiles(path, paths)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(dirty) > 0 {
+		return fmt.Errorf("refusing to overwrite uncommitted changes in %q, commit them or use --force", dirty)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefuseUncommitted(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-cmd-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	oldPath := path
+	path = p
+	defer func() { path = oldPath }()
+
+	files := []string{"clean.tf", "Dockerfile", "kbst.hcl", "service.tf.json"}
+	for _, f := range files {
+		os.WriteFile(filepath.Join(p, f), []byte("# a\n"), 0644)
+	}
+
+	repo, err := git.PlainInit(p, false)
+	assert.Equal(t, nil, err, nil)
+	wt, _ := repo.Worktree()
+	for _, f := range files {
+		wt.Add(f)
+	}
+	_, err = wt.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	assert.Equal(t, nil, err, nil)
+
+	paths := []string{}
+	for _, f := range files {
+		paths = append(paths, filepath.Join(p, f))
+	}
+
+	err = refuseUncommitted(paths)
+	assert.Equal(t, nil, err, nil)
+
+	// edits in files other than .tf are refused as well
+	for _, f := range files[1:] {
+		os.WriteFile(filepath.Join(p, f), []byte("# b\n"), 0644)
+	}
+
+	err = refuseUncommitted(paths)
+	assert.EqualError(t, err, `refusing to overwrite uncommitted changes in ["Dockerfile" "kbst.hcl" "service.tf.json"], commit them or use --force`, nil)
+}
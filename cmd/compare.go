@@ -0,0 +1,70 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/kbst/kbst/pkg/export"
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var compareFormat string
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <path-a> <path-b>",
+	Short: "Compare clusters, node pools and services of two repositories",
+	Long: `Compare clusters, node pools and services of two repositories.
+
+Clusters are matched by provider and region, ignoring their name prefix,
+if each repository has exactly one cluster of that provider and region.
+Differences are reported with the module names of <path-a>.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		cj := util.CliJSON{}
+		err := cj.Load(util.CachedDownloader{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		stacks := []export.Stack{}
+		for _, p := range args {
+			s := stack.NewStack(tfhcl.NewRoot(p), cj)
+			err = s.FromPath()
+			if err != nil {
+				log.Fatalf("%s: %s", p, err)
+			}
+
+			stacks = append(stacks, export.FromStack(s))
+		}
+
+		diffs := export.Compare(stacks[0], stacks[1])
+
+		err = printStackDiff(cmd.OutOrStdout(), diffs, compareFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringVarP(&compareFormat, "format", "f", "text", "output format, text, markdown or json")
+}
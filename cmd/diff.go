@@ -0,0 +1,161 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/kbst/kbst/cli"
+	"github.com/kbst/kbst/pkg/export"
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var diffFormat string
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [<rev>]",
+	Short: "Compare clusters, node pools and services of a git revision, default HEAD, with the working tree",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		rev := "HEAD"
+		if len(args) == 1 {
+			rev = args[0]
+		}
+
+		cj := util.CliJSON{}
+		err := cj.Load(util.CachedDownloader{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		rfs, err := cli.Repo{}.RevisionFS(path, rev)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		from := stack.NewStack(tfhcl.NewRootFS(path, rfs), cj)
+		err = from.FromPath()
+		if err != nil {
+			log.Fatalf("revision %s: %s", rev, err)
+		}
+
+		to := stack.NewStack(tfhcl.NewRoot(path), cj)
+		err = to.FromPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		diffs := export.Diff(export.FromStack(from), export.FromStack(to))
+
+		err = printStackDiff(cmd.OutOrStdout(), diffs, diffFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func printStackDiff(out io.Writer, diffs []export.ModuleDiff, format string) error {
+	switch format {
+	case "text":
+		if len(diffs) == 0 {
+			fmt.Fprintln(out, "No changes.")
+			return nil
+		}
+
+		for _, d := range diffs {
+			fmt.Fprintf(out, "%s %s: %s\n", d.Type, d.Name, d.Change)
+			if d.FromVersion != d.ToVersion {
+				fmt.Fprintf(out, "  version: %s -> %s\n", versionValue(d.FromVersion), versionValue(d.ToVersion))
+			}
+			for _, a := range d.Attributes {
+				fmt.Fprintf(out, "  %s.%s: %s -> %s\n", a.EnvironmentKey, a.Name, attributeValue(a.From), attributeValue(a.To))
+			}
+		}
+
+		return nil
+	case "markdown":
+		if len(diffs) == 0 {
+			fmt.Fprintln(out, "No changes to clusters, node pools or services.")
+			return nil
+		}
+
+		fmt.Fprintf(out, "| Type | Name | Change | Version |\n|---|---|---|---|\n")
+		for _, d := range diffs {
+			version := ""
+			if d.FromVersion != d.ToVersion {
+				version = fmt.Sprintf("%s → %s", versionValue(d.FromVersion), versionValue(d.ToVersion))
+			}
+			fmt.Fprintf(out, "| %s | `%s` | %s | %s |\n", d.Type, d.Name, d.Change, version)
+		}
+
+		for _, d := range diffs {
+			if d.Change != "changed" {
+				continue
+			}
+
+			if len(d.Attributes) == 0 {
+				continue
+			}
+
+			fmt.Fprintf(out, "\n**%s `%s`**\n\n", d.Type, d.Name)
+			for _, a := range d.Attributes {
+				fmt.Fprintf(out, "- `%s.%s`: `%s` → `%s`\n", a.EnvironmentKey, a.Name, attributeValue(a.From), attributeValue(a.To))
+			}
+		}
+
+		return nil
+	case "json":
+		if diffs == nil {
+			diffs = []export.ModuleDiff{}
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	}
+
+	return fmt.Errorf("invalid format %q, choose one of [text markdown json]", format)
+}
+
+// versionValue returns v, or a placeholder if it is not set
+func versionValue(v string) string {
+	if v == "" {
+		return "-"
+	}
+
+	return v
+}
+
+// attributeValue returns v, or a placeholder if it is not set
+func attributeValue(v json.RawMessage) string {
+	if len(v) == 0 {
+		return "(unset)"
+	}
+
+	return string(v)
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVarP(&diffFormat, "format", "f", "text", "output format, text, markdown or json")
+}
@@ -0,0 +1,110 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/spf13/cobra"
+)
+
+// addDryRunFlags adds --dry-run and --output to cmd
+// and its subcommands
+func addDryRunFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print changes as a diff instead of writing them")
+	cmd.PersistentFlags().StringVar(&dryRunOutput, "output", "diff", "dry-run output format, diff or patch")
+}
+
+// validateDryRunOutput returns an error if --output is invalid
+func validateDryRunOutput() error {
+	if dryRunOutput != "diff" && dryRunOutput != "patch" {
+		return fmt.Errorf("invalid output %q, choose one of [diff patch]", dryRunOutput)
+	}
+
+	return nil
+}
+
+// printDryRun prints the changes of a dry-run,
+// it does nothing if --dry-run is not set
+func printDryRun(cmd *cobra.Command, r *tfhcl.Root) error {
+	if !dryRun {
+		return nil
+	}
+
+	changes, err := r.Changes()
+	if err != nil {
+		return err
+	}
+
+	return printChanges(cmd, changes)
+}
+
+func printChanges(cmd *cobra.Command, changes []tfhcl.FileChange) error {
+	out, err := tfhcl.UnifiedDiff(changes, dryRunOutput == "patch")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(cmd.OutOrStdout(), out)
+
+	return nil
+}
+
+// dirChanges returns all files below dir as created,
+// with paths relative to dir, skipping the .git directory
+func dirChanges(dir string) (changes []tfhcl.FileChange, err error) {
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		changes = append(changes, tfhcl.FileChange{
+			Path: filepath.ToSlash(rel),
+			Mode: fi.Mode(),
+			To:   data,
+		})
+
+		return nil
+	})
+
+	return changes, err
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/kbst/kbst/pkg/export"
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var exportFormat string
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print the clusters, node pools and services of the repository as JSON or YAML",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cj := util.CliJSON{}
+		err := cj.Load(util.CachedDownloader{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s := stack.NewStack(tfhcl.NewRoot(path), cj)
+		err = s.FromPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		data, err := export.Marshal(export.FromStack(s), exportFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = cmd.OutOrStdout().Write(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var exportSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the export format, to validate documents for import and apply",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := export.JSONSchema()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = cmd.OutOrStdout().Write(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportSchemaCmd)
+
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "json", "output format, json or yaml")
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var graphFormat string
+var graphEnvironment string
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Render clusters, node pools, services and modules as a graph",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cj := util.CliJSON{}
+		err := cj.Load(util.CachedDownloader{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		r := tfhcl.NewRoot(path)
+		s := stack.NewStack(r, cj)
+		err = s.FromPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		g, err := s.Graph(graphEnvironment)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		switch graphFormat {
+		case "dot":
+			fmt.Fprint(cmd.OutOrStdout(), g.DOT())
+		case "mermaid":
+			fmt.Fprint(cmd.OutOrStdout(), g.Mermaid())
+		default:
+			log.Fatalf("invalid format %q, choose one of [dot mermaid]", graphFormat)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+
+	graphCmd.Flags().StringVarP(&graphFormat, "format", "f", "dot", "output format, dot or mermaid")
+	graphCmd.Flags().StringVarP(&graphEnvironment, "env", "e", "", "annotate node counts and instance types of this environment")
+}
@@ -16,44 +16,148 @@ limitations under the License.
 package cmd
 
 import (
-	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"os"
 
 	"github.com/kbst/kbst/cli"
 	"github.com/kbst/kbst/pkg/export"
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/tfhcl"
 	"github.com/kbst/kbst/pkg/util"
 	"github.com/spf13/cobra"
 )
 
+var importMerge bool
+var importOnConflict string
+
 var importCmd = &cobra.Command{
-	Use:    "import JSON",
-	Short:  "Create new repository imported from JSON string",
-	Args:   cobra.ExactArgs(1),
+	Use:   "import [FILE]",
+	Short: "Create new repository, or merge into the existing one, imported from a file or stdin",
+	Long: `Import a stack in export or generator format, as JSON or YAML,
+from FILE or, if FILE is omitted or -, from stdin.
+
+Without --merge, a new repository is created from the starter. With
+--merge, missing clusters, node pools and services are added to the
+repository at --path and existing ones are handled as --on-conflict says.`,
+	Args:   cobra.MaximumNArgs(1),
 	Hidden: true,
 	Run: func(cmd *cobra.Command, args []string) {
-		cj := util.CliJSON{}
-		err := cj.Load(util.CachedDownloader{})
+		name := "-"
+		if len(args) == 1 {
+			name = args[0]
+		}
+
+		data, err := readInput(cmd, name)
 		if err != nil {
 			log.Fatal(err)
 		}
-		r := cli.Repo{
-			Framework:  cj.Framework,
-			Downloader: util.CachedDownloader{},
+
+		iS, err := export.Unmarshal(data)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		iS := export.Stack{}
-		err = json.Unmarshal([]byte(args[0]), &iS)
+		cj := util.CliJSON{Channel: channel}
+		err = cj.Load(util.CachedDownloader{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		err = r.Import(iS, path)
+		if importMerge {
+			err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+				s := stack.NewStack(r, cj)
+				err = s.FromPath()
+				if err != nil {
+					return "", err
+				}
+
+				changes, err := export.Merge(s, iS, importOnConflict)
+				for _, mc := range changes {
+					fmt.Fprintln(cmd.OutOrStdout(), mc)
+				}
+				if err != nil {
+					return "", err
+				}
+
+				return "Merge import", nil
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			return
+		}
+
+		err = importRepository(cmd, cj, iS)
 		if err != nil {
 			log.Fatal(err)
 		}
 	},
 }
 
+// importRepository creates a new repository at path from es,
+// on dry-run it scaffolds into a temporary directory and prints
+// all files as created, flags only --merge supports are rejected
+func importRepository(cmd *cobra.Command, cj util.CliJSON, es export.Stack) error {
+	for _, f := range []string{"commit", "branch", "force", "lock-timeout"} {
+		if cmd.Flags().Changed(f) {
+			return fmt.Errorf("--%s requires --merge", f)
+		}
+	}
+
+	err := validateDryRunOutput()
+	if err != nil {
+		return err
+	}
+
+	r := cli.Repo{
+		Framework:  cj.Framework,
+		Downloader: util.CachedDownloader{},
+		Channel:    channel,
+	}
+
+	target := path
+	if dryRun {
+		target, err = os.MkdirTemp("", "kbst-import-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(target)
+	}
+
+	err = r.Import(es, target)
+	if err != nil {
+		return err
+	}
+
+	if !dryRun {
+		return nil
+	}
+
+	changes, err := dirChanges(target)
+	if err != nil {
+		return err
+	}
+
+	return printChanges(cmd, changes)
+}
+
+// readInput reads the file name, or stdin if name is -
+func readInput(cmd *cobra.Command, name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(cmd.InOrStdin())
+	}
+
+	return os.ReadFile(name)
+}
+
 func init() {
 	rootCmd.AddCommand(importCmd)
+
+	addMutationFlags(importCmd)
+
+	importCmd.Flags().BoolVar(&importMerge, "merge", false, "merge into the repository at --path instead of creating a new one")
+	importCmd.Flags().StringVar(&importOnConflict, "on-conflict", "fail", "for modules that already exist, skip, overwrite or fail")
 }
@@ -0,0 +1,103 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List recorded changes that can be undone",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		r := tfhcl.NewRoot(path)
+
+		entries, err := r.Journal()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, e := range entries {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s  %s  %s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04:05"), strings.SplitN(e.Message, "\n", 2)[0])
+			for _, f := range e.Files {
+				fmt.Fprintf(cmd.OutOrStdout(), "    %-8s %s\n", f.Action(), f.Path)
+			}
+		}
+	},
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Restore the files changed by the most recent recorded change",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// not using newRoot, undo checks for changes
+		// since the recorded change itself
+		err := validateDryRunOutput()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		r := tfhcl.NewRoot(path)
+		r.DryRun = dryRun
+
+		err = withLock(r, func() error {
+			err := r.Read()
+			if err != nil {
+				return err
+			}
+
+			entries, err := r.Journal()
+			if err != nil {
+				return err
+			}
+
+			if len(entries) == 0 {
+				return errors.New("nothing to undo")
+			}
+
+			e := entries[0]
+			err = r.Undo(e, force)
+			if err != nil {
+				return err
+			}
+
+			err = printDryRun(cmd, r)
+			if err != nil {
+				return err
+			}
+
+			return commitChanges(r, fmt.Sprintf("Undo %s", e.Message))
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(undoCmd)
+
+	addMutationFlags(undoCmd)
+}
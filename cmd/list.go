@@ -55,21 +55,35 @@ var listCmd = &cobra.Command{
 
 		w := tabwriter.NewWriter(os.Stdout, 4, 8, 2, '\t', 0)
 		line := "%s\t%s\t%s\n"
+		header := []interface{}{"TYPE", "NAME", "VERSION"}
+		if showAll {
+			// custom modules show their resolved source
+			line = "%s\t%s\t%s\t%s\n"
+			header = append(header, "SOURCE")
+		}
+
+		// row pads the columns only shown with --all
+		row := func(cols ...interface{}) []interface{} {
+			for len(cols) < len(header) {
+				cols = append(cols, "")
+			}
+			return cols
+		}
 
 		filterCustomModules := []string{}
 		for _, c := range clusters {
-			fmt.Fprintf(w, line, "TYPE", "NAME", "VERSION")
-			fmt.Fprintf(w, line, "cluster", c.Name(), c.Version)
+			fmt.Fprintf(w, line, header...)
+			fmt.Fprintf(w, line, row("cluster", c.Name(), c.Version)...)
 
 			for _, np := range nodePools {
 				if np.ClusterName == c.Name() {
-					fmt.Fprintf(w, line, "node-pool", np.Name(), np.Version)
+					fmt.Fprintf(w, line, row("node-pool", np.Name(), np.Version)...)
 				}
 			}
 
 			for _, svc := range services {
 				if svc.ClusterName == c.Name() {
-					fmt.Fprintf(w, line, "service", svc.Name(), svc.Version)
+					fmt.Fprintf(w, line, row("service", svc.Name(), svc.Version)...)
 				}
 			}
 
@@ -79,21 +93,21 @@ var listCmd = &cobra.Command{
 						// if custom modules are prefixed
 						// with the name of a cluster show them here
 						filterCustomModules = append(filterCustomModules, m.Name())
-						fmt.Fprintf(w, line, "custom", m.Name(), "")
+						fmt.Fprintf(w, line, "custom", m.Name(), "", m.Source())
 					}
 				}
 			}
 
-			fmt.Fprintf(w, line, "", "", "")
+			fmt.Fprintf(w, line, row()...)
 		}
 
 		// show custom modules that were not
 		// prefixed with a cluster name
 		if showAll && len(modules) > 0 {
-			fmt.Fprintf(w, line, "TYPE", "NAME", "VERSION")
+			fmt.Fprintf(w, line, header...)
 			for _, m := range modules {
 				if !slices.Contains(filterCustomModules, m.Name()) {
-					fmt.Fprintf(w, line, "custom", m.Name(), "")
+					fmt.Fprintf(w, line, "custom", m.Name(), "", m.Source())
 				}
 			}
 		}
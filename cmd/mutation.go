@@ -0,0 +1,117 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/spf13/cobra"
+)
+
+var lockTimeout time.Duration
+
+// addMutationFlags adds the flags of commands changing
+// the repository to cmd and its subcommands
+func addMutationFlags(cmd *cobra.Command) {
+	addDryRunFlags(cmd)
+	addChannelFlag(cmd)
+	cmd.PersistentFlags().BoolVar(&autoCommit, "commit", commitDefault(), "commit changed files to git (default from KBST_COMMIT)")
+	cmd.PersistentFlags().StringVar(&commitBranch, "branch", "", "create or check out this branch and commit changed files to it")
+	cmd.PersistentFlags().BoolVar(&force, "force", false, "overwrite files with uncommitted changes")
+	cmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", 30*time.Second, "how long to wait for other kbst processes to release the repository lock")
+}
+
+// newRoot returns a root for the working directory that
+// keeps changes in memory if --dry-run is set and refuses to
+// overwrite uncommitted changes unless --force is set
+func newRoot() *tfhcl.Root {
+	r := tfhcl.NewRoot(path)
+	r.DryRun = dryRun
+
+	if !force {
+		r.BeforeWrite = refuseUncommitted
+	}
+
+	return r
+}
+
+// withLock locks r, calls f and releases the lock before
+// returning, also if f fails, unlike deferring Unlock in a
+// command that exits with log.Fatal
+func withLock(r *tfhcl.Root, f func() error) (err error) {
+	err = r.Lock(lockTimeout)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		uerr := r.Unlock()
+		if err == nil {
+			err = uerr
+		}
+	}()
+
+	return f()
+}
+
+// runMutation calls mutate with a locked root from newRoot and
+// finishes the mutation with the message mutate returns, an
+// empty message means mutate did not change anything
+func runMutation(cmd *cobra.Command, mutate func(r *tfhcl.Root) (string, error)) error {
+	err := validateDryRunOutput()
+	if err != nil {
+		return err
+	}
+
+	r := newRoot()
+
+	return withLock(r, func() error {
+		msg, err := mutate(r)
+		if err != nil {
+			// changes written before the error are
+			// recorded, so undo can restore them
+			_, jerr := r.RecordJournal(fmt.Sprintf("Failed %s", cmd.CommandPath()))
+			if jerr != nil {
+				return fmt.Errorf("%s, recording the journal failed: %s", err, jerr)
+			}
+
+			return err
+		}
+		if msg == "" {
+			return nil
+		}
+
+		return finishMutation(cmd, r, msg)
+	})
+}
+
+// finishMutation prints the changes of a dry-run, records
+// them in the journal and commits them if requested
+func finishMutation(cmd *cobra.Command, r *tfhcl.Root, msg string) error {
+	err := printDryRun(cmd, r)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.RecordJournal(msg)
+	if err != nil {
+		return err
+	}
+
+	return commitChanges(r, msg)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunMutationErrorReleasesLock(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-cmd-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	oldPath := path
+	path = p
+	defer func() { path = oldPath }()
+
+	failed := errors.New("failed")
+	err = runMutation(rootCmd, func(r *tfhcl.Root) (string, error) {
+		assert.FileExists(t, filepath.Join(p, tfhcl.LockPath), nil)
+		return "", failed
+	})
+	assert.ErrorIs(t, err, failed, nil)
+	assert.NoFileExists(t, filepath.Join(p, tfhcl.LockPath), nil)
+}
+
+func TestRunMutationErrorRecordsJournal(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-cmd-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	oldPath := path
+	path = p
+	defer func() { path = oldPath }()
+
+	failed := errors.New("failed")
+	err = runMutation(rootCmd, func(r *tfhcl.Root) (string, error) {
+		err := r.WriteFiles(map[string][]byte{"written.tf": []byte("locals {}\n")})
+		assert.Equal(t, nil, err, nil)
+
+		err = r.Write()
+		assert.Equal(t, nil, err, nil)
+
+		return "", failed
+	})
+	assert.ErrorIs(t, err, failed, nil)
+
+	es, err := tfhcl.NewRoot(p).Journal()
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, es, 1, nil)
+	assert.Equal(t, "Failed kbst", es[0].Message, nil)
+	assert.Equal(t, "written.tf", es[0].Files[0].Path, nil)
+}
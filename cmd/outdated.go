@@ -0,0 +1,105 @@
+/*
+Copyright © 2020 Kubestack <hello@kubestack.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"text/tabwriter"
+
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var outdatedFormat string
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "Report current and latest versions of cluster, node pool, service and elb-dns modules",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		statuses, err := moduleStatuses(stack.UpdateFilter{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = printModuleStatuses(cmd.OutOrStdout(), statuses, outdatedFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func moduleStatuses(f stack.UpdateFilter) (statuses []stack.ModuleStatus, err error) {
+	cj := util.CliJSON{Channel: channel}
+	err = cj.Load(util.CachedDownloader{})
+	if err != nil {
+		return statuses, err
+	}
+
+	r := tfhcl.NewRoot(path)
+	s := stack.NewStack(r, cj)
+	err = s.FromPath()
+	if err != nil {
+		return statuses, err
+	}
+
+	return s.Outdated(f)
+}
+
+func printModuleStatuses(out io.Writer, statuses []stack.ModuleStatus, format string) error {
+	switch format {
+	case "table":
+		w := tabwriter.NewWriter(out, 4, 8, 2, '\t', 0)
+		line := "%s\t%s\t%s\t%s\t%s\n"
+
+		fmt.Fprintf(w, line, "TYPE", "NAME", "CURRENT", "LATEST", "BEHIND")
+		for _, ms := range statuses {
+			latest, behind := ms.Latest, ms.Behind
+			if latest == "" {
+				latest = "unknown"
+			}
+			if behind == "" {
+				behind = "-"
+			}
+			fmt.Fprintf(w, line, ms.Type, ms.Name, ms.Current, latest, behind)
+		}
+
+		return w.Flush()
+	case "json":
+		if statuses == nil {
+			statuses = []stack.ModuleStatus{}
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+
+	return fmt.Errorf("invalid format %q, choose one of [table json]", format)
+}
+
+func init() {
+	rootCmd.AddCommand(outdatedCmd)
+
+	addChannelFlag(outdatedCmd)
+
+	outdatedCmd.Flags().StringVarP(&outdatedFormat, "format", "f", "table", "output format, table or json")
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/kbst/kbst/pkg/stack"
@@ -31,20 +32,26 @@ var removeCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
 
-		cj := util.CliJSON{}
+		cj := util.CliJSON{Channel: channel}
 		err := cj.Load(util.CachedDownloader{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		r := tfhcl.NewRoot(path)
-		s := stack.NewStack(r, cj)
-		err = s.FromPath()
-		if err != nil {
-			log.Fatal(err)
-		}
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
 
-		err = s.Remove(name)
+			err = s.Remove(name)
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("Remove %s", name), nil
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -53,4 +60,6 @@ var removeCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(removeCmd)
+
+	addMutationFlags(removeCmd)
 }
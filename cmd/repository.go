@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"log"
+	"os"
 	"strings"
 
 	"github.com/kbst/kbst/cli"
@@ -43,7 +44,7 @@ var initAKSCmd = &cobra.Command{
 	Short: "Scaffold a repository with one AKS cluster",
 	Args:  cobra.ExactArgs(4),
 	Run: func(cmd *cobra.Command, args []string) {
-		initStarter("aks", args)
+		initStarter(cmd, "aks", args)
 	},
 }
 
@@ -52,7 +53,7 @@ var initEKSCmd = &cobra.Command{
 	Short: "Scaffold a repository with one EKS cluster",
 	Args:  cobra.ExactArgs(3),
 	Run: func(cmd *cobra.Command, args []string) {
-		initStarter("eks", args)
+		initStarter(cmd, "eks", args)
 	},
 }
 
@@ -61,19 +62,25 @@ var initGKECmd = &cobra.Command{
 	Short: "Scaffold a repository with one GKE cluster",
 	Args:  cobra.ExactArgs(4),
 	Run: func(cmd *cobra.Command, args []string) {
-		initStarter("gke", args)
+		initStarter(cmd, "gke", args)
 	},
 }
 
-func initStarter(starter string, args []string) {
-	cj := util.CliJSON{}
-	err := cj.Load(util.CachedDownloader{})
+func initStarter(cmd *cobra.Command, starter string, args []string) {
+	err := validateDryRunOutput()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cj := util.CliJSON{Channel: channel}
+	err = cj.Load(util.CachedDownloader{})
 	if err != nil {
 		log.Fatal(err)
 	}
 	r := cli.Repo{
 		Framework:  cj.Framework,
 		Downloader: util.CachedDownloader{},
+		Channel:    channel,
 	}
 
 	baseDomain := args[0]
@@ -133,19 +140,44 @@ func initStarter(starter string, args []string) {
 		log.Fatalf("unexpected error: starter: '%s' exists as archive, but is not implemented in CLI", starter)
 	}
 
-	err = r.Init(starter, baseDomain, namePrefix, region, strings.Split(initEnvNames, ","), baseCfg, initRelease, initGitRef, path)
+	// on dry-run, scaffold into a temporary directory
+	// and print all files as created
+	target := path
+	if dryRun {
+		target, err = os.MkdirTemp("", "kbst-init-*")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(target)
+	}
+
+	err = r.Init(starter, baseDomain, namePrefix, region, strings.Split(initEnvNames, ","), baseCfg, initRelease, initGitRef, target)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if dryRun {
+		changes, err := dirChanges(target)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = printChanges(cmd, changes)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(initCmd)
 
+	addDryRunFlags(initCmd)
+	addChannelFlag(initCmd)
 	initCmd.PersistentFlags().AddFlagSet(&sharedFlags)
 	initCmd.PersistentFlags().StringVar(&initEnvNames, "environment-names", "apps,ops", "list of environment names, mission critical first")
 
-	initCmd.PersistentFlags().StringVar(&initRelease, "release", "latest", "desired release version")
+	initCmd.PersistentFlags().StringVar(&initRelease, "release", "latest", "desired release version or constraint, e.g. '~> 0.18'")
 	initCmd.PersistentFlags().StringVar(&initGitRef, "gitref", "", "git ref to download a dev artifact")
 	initCmd.PersistentFlags().MarkHidden("gitref")
 
@@ -18,6 +18,7 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"log"
 
 	"github.com/kbst/kbst/pkg/util"
 	"github.com/spf13/cobra"
@@ -27,12 +28,22 @@ import (
 var ErrMissingCommand = errors.New("missing command")
 
 var path string
+var dryRun bool
+var dryRunOutput string
+var channel string
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "kbst command [flags]",
 	Short: "Kubestack Framework CLI",
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if channel != "" {
+			err := util.ValidateChannel(channel)
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+
 		if cmd.Version == "" {
 			return
 		}
@@ -68,3 +79,8 @@ func Execute(version, commit string) error {
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&path, "path", "p", ".", "path to the working directory")
 }
+
+// addChannelFlag adds --channel to cmd and its subcommands
+func addChannelFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&channel, "channel", "", "only consider framework and catalog versions of this channel, stable, beta or dev (default from project config, or all)")
+}
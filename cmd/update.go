@@ -16,97 +16,156 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"log"
 	"strings"
 
-	"github.com/hashicorp/hcl/v2"
-	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/kbst/kbst/pkg/stack"
 	"github.com/kbst/kbst/pkg/tfhcl"
 	"github.com/kbst/kbst/pkg/util"
 	"github.com/spf13/cobra"
-	"github.com/zclconf/go-cty/cty"
 )
 
+var updateFilter stack.UpdateFilter
+var updateCheck bool
+var updatePolicy stack.UpgradePolicy
+
 var updateCmd = &cobra.Command{
-	Use:   "update",
+	Use:   "update [module-name]",
 	Short: "Update cluster, node pool or service module versions",
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		cj := util.CliJSON{}
-		err := cj.Load(util.CachedDownloader{})
-		if err != nil {
-			log.Fatal(err)
+		if len(args) > 0 {
+			updateFilter.Module = args[0]
 		}
 
-		r := tfhcl.NewRoot(path)
+		if updateCheck {
+			checkOutdated(cmd)
+			return
+		}
 
-		s := stack.NewStack(r, cj)
-		err = s.FromPath()
+		cj := util.CliJSON{Channel: channel}
+		err := cj.Load(util.CachedDownloader{})
 		if err != nil {
-			log.Fatalln(err)
+			log.Fatal(err)
 		}
 
-		toWrite := map[string][]byte{}
+		err = runMutation(cmd, func(r *tfhcl.Root) (string, error) {
+			s := stack.NewStack(r, cj)
+			err = s.FromPath()
+			if err != nil {
+				return "", err
+			}
 
-		for n, f := range r.Parser.Files() {
-			wf, diag := hclwrite.ParseConfig(f.Bytes, n, hcl.InitialPos)
-			if diag.HasErrors() {
-				continue
+			updateFilter.Policy, err = upgradePolicy(cmd, s)
+			if err != nil {
+				return "", err
 			}
 
-			for i, b := range wf.Body().Blocks() {
-				if b.Type() != "module" {
-					continue
-				}
+			updates, warnings, err := s.Update(updateFilter)
+			if err != nil {
+				return "", err
+			}
 
-				m := r.Modules[n][i]
+			for _, w := range warnings {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", w)
+			}
 
-				t, _, _, err := m.TypeProviderVersion()
-				if err != nil {
-					continue
-				}
+			msg := []string{"Update module versions", ""}
+			for _, u := range updates {
+				fmt.Fprintln(cmd.ErrOrStderr(), u)
+				msg = append(msg, fmt.Sprintf("- %s", u))
 
-				var latestVersion string
-				if t == "cluster" || t == "node-pool" || t == "elb-dns" {
-					latestVersion = cj.Framework.Versions[0].Name
+				if len(u.Path) > 1 {
+					path := strings.Join(append([]string{u.From}, u.Path...), " -> ")
+					fmt.Fprintf(cmd.ErrOrStderr(), "  upgrade path: %s\n", path)
 				}
 
-				if t == "service" {
-					name := strings.Split(m.Source, "/")[2]
-					if vers, ok := cj.Catalog[name]; ok {
-						latestVersion = vers.Versions[0].Name
+				for _, m := range u.Migrations {
+					for _, c := range m.Changes() {
+						fmt.Fprintf(cmd.ErrOrStderr(), "  %s: %s\n", m.To, c)
+						msg = append(msg, fmt.Sprintf("  - %s: %s", m.To, c))
 					}
 				}
-
-				if latestVersion == "" {
-					continue
-				}
-
-				if b.Body().GetAttribute("version") != nil {
-					v := strings.TrimPrefix(latestVersion, "v")
-					b.Body().SetAttributeValue("version", cty.StringVal(v))
-				} else {
-					currentRef := strings.Split(m.Source, "?ref=")[1]
-					s := strings.Replace(m.Source, currentRef, latestVersion, 1)
-					b.Body().SetAttributeValue("source", cty.StringVal(s))
-				}
 			}
 
-			toWrite[n] = wf.Bytes()
+			return strings.Join(msg, "\n"), nil
+		})
+		if err != nil {
+			log.Fatal(err)
 		}
+	},
+}
 
-		err = r.WriteFiles(toWrite)
-		if err != nil {
-			log.Fatalln(err)
+// upgradePolicy returns the upgrade policy of the project
+// configuration, overridden by the flags set explicitly
+func upgradePolicy(cmd *cobra.Command, s *stack.Stack) (p stack.UpgradePolicy, err error) {
+	pc, err := s.ProjectConfig()
+	if err != nil {
+		return p, err
+	}
+
+	if pc.Update != nil {
+		p = *pc.Update
+	}
+
+	if cmd.Flags().Changed("allow-prerelease") {
+		p.AllowPrerelease = updatePolicy.AllowPrerelease
+	}
+
+	if cmd.Flags().Changed("max-minor-bump") {
+		if updatePolicy.MaxMinorBump < 0 {
+			return p, fmt.Errorf("invalid --max-minor-bump %d, must not be negative", updatePolicy.MaxMinorBump)
 		}
+		p.MaxMinorBump = updatePolicy.MaxMinorBump
+	}
 
-		err = r.Write()
-		if err != nil {
-			log.Fatalln(err)
+	if cmd.Flags().Changed("required") {
+		p.Required = append(p.Required, updatePolicy.Required...)
+	}
+
+	return p, nil
+}
+
+// checkOutdated prints the outdated modules matching
+// the update filter and exits non-zero if there are any
+func checkOutdated(cmd *cobra.Command) {
+	statuses, err := moduleStatuses(updateFilter)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	outdated := []stack.ModuleStatus{}
+	for _, ms := range statuses {
+		if ms.Outdated() {
+			outdated = append(outdated, ms)
 		}
-	},
+	}
+
+	if len(outdated) == 0 {
+		return
+	}
+
+	err = printModuleStatuses(cmd.OutOrStdout(), outdated, outdatedFormat)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	log.Fatalf("%d modules are outdated", len(outdated))
 }
 
 func init() {
 	rootCmd.AddCommand(updateCmd)
+
+	addMutationFlags(updateCmd)
+
+	updateCmd.Flags().StringVar(&updateFilter.Cluster, "cluster", "", "only update modules of this cluster")
+	updateCmd.Flags().StringVar(&updateFilter.Type, "type", "", "only update modules of this type, cluster, node-pool or service")
+	updateCmd.Flags().StringVar(&updateFilter.Service, "service", "", "only update services of this catalog entry")
+	updateCmd.Flags().StringVar(&updateFilter.To, "to", "latest", "version or constraint to update to, e.g. '>= 0.17, < 0.19'")
+	updateCmd.Flags().BoolVar(&updatePolicy.AllowPrerelease, "allow-prerelease", false, "allow upgrading framework modules from stable to pre-release versions")
+	updateCmd.Flags().IntVar(&updatePolicy.MaxMinorBump, "max-minor-bump", 0, "maximum framework minor versions to upgrade per step, 0 for no limit")
+	updateCmd.Flags().StringSliceVar(&updatePolicy.Required, "required", []string{}, "framework versions that can not be skipped when upgrading")
+	updateCmd.Flags().BoolVar(&updateCheck, "check", false, "do not update, exit non-zero if any module is outdated")
+	updateCmd.Flags().StringVarP(&outdatedFormat, "format", "f", "table", "output format of --check, table or json")
 }
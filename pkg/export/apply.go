@@ -0,0 +1,276 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Plan returns the changes that reconcile s with the desired
+// state es, missing modules are added and modules with different
+// versions or configurations updated, if prune is set, modules
+// es does not declare are removed, an empty version or service
+// configurations in es keep the current ones
+func Plan(s *stack.Stack, es Stack, prune bool) (changes []Change, err error) {
+	err = mergeEnvironments(s, es)
+	if err != nil {
+		return changes, err
+	}
+
+	current := FromStack(s)
+	clusters := s.Clusters()
+	nodePools := s.NodePools()
+	services := s.Services()
+
+	// versions holds the desired version of each cluster,
+	// bumped the clusters updated, with their node pools
+	versions := map[string]string{}
+	for _, c := range clusters {
+		versions[c.Name()] = c.Version
+	}
+	bumped := map[string]bool{}
+
+	declaredClusters := map[string]bool{}
+	for _, c := range es.Clusters {
+		c := c
+		cfgs := es.StackConfigurations(c.Configurations)
+		sc := stack.Cluster{NamePrefix: c.NamePrefix, Provider: c.Provider, Region: c.Region}
+		declaredClusters[c.NamePrefix+"/"+c.Provider+"/"+c.Region] = true
+
+		i := -1
+		for j, ec := range clusters {
+			if ec.NamePrefix == c.NamePrefix && ec.Provider == c.Provider && ec.Region == c.Region {
+				i = j
+			}
+		}
+
+		if i == -1 {
+			versions[sc.Name()] = c.Version
+			changes = append(changes, Change{Type: "cluster", Name: sc.Name(), Action: "add", apply: func(s *stack.Stack) error {
+				_, err := s.AddCluster(c.NamePrefix, c.Provider, c.Region, c.Version, cfgs)
+				return err
+			}})
+			continue
+		}
+
+		cur := current.Clusters[i]
+		if c.Version == "" {
+			c.Version = cur.Version
+		}
+		versions[clusters[i].Name()] = c.Version
+
+		desired := exportConfigurations(cfgs, map[string]cty.Value{"base_domain": cty.StringVal(s.BaseDomain())})
+		if sameVersion(c.Version, cur.Version) && sameConfigurations(desired, cur.Configurations) {
+			continue
+		}
+
+		bumped[clusters[i].Name()] = true
+		changes = append(changes, Change{Type: "cluster", Name: clusters[i].Name(), Action: "update", apply: func(s *stack.Stack) error {
+			_, err := s.ReplaceCluster(c.NamePrefix, c.Provider, c.Region, c.Version, cfgs)
+			return err
+		}})
+	}
+
+	declaredNodePools := map[string]bool{}
+	for _, np := range es.NodePools {
+		np := np
+		cfgs := es.StackConfigurations(np.Configurations)
+		declaredNodePools[np.ClusterName+"/"+np.PoolName] = true
+
+		i := -1
+		for j, enp := range nodePools {
+			if enp.ClusterName == np.ClusterName && enp.PoolName == np.PoolName {
+				i = j
+			}
+		}
+
+		// node pools use the version of their cluster, a
+		// different version is an error, unless it is the
+		// current one, that updating the cluster bumps
+		cv := versions[np.ClusterName]
+		changed := i == -1 || !sameVersion(np.Version, current.NodePools[i].Version)
+		if np.Version != "" && cv != "" && changed && !sameVersion(np.Version, cv) && !sameVersion(cv, np.Version) {
+			return changes, fmt.Errorf("node pool %q of cluster %q: version %q differs from the cluster's %q, node pools use the version of their cluster", np.PoolName, np.ClusterName, np.Version, cv)
+		}
+
+		if i == -1 {
+			snp := stack.NodePool{ClusterName: np.ClusterName, PoolName: np.PoolName}
+			changes = append(changes, Change{Type: "node pool", Name: snp.Name(), Action: "add", apply: func(s *stack.Stack) error {
+				_, err := s.AddNodePool(np.ClusterName, np.PoolName, cfgs)
+				return err
+			}})
+			continue
+		}
+
+		// node pools behind their cluster's version are updated,
+		// unless updating the cluster already bumps them
+		cur := current.NodePools[i]
+		behind := !bumped[np.ClusterName] && !sameVersion(cv, cur.Version)
+		if !behind && sameConfigurations(exportConfigurations(cfgs, nil), cur.Configurations) {
+			continue
+		}
+
+		changes = append(changes, Change{Type: "node pool", Name: nodePools[i].Name(), Action: "update", apply: func(s *stack.Stack) error {
+			_, err := s.ReplaceNodePool(np.ClusterName, np.PoolName, cfgs)
+			return err
+		}})
+	}
+
+	declaredServices := map[string]bool{}
+	for _, svc := range es.Services {
+		svc := svc
+		declaredServices[svc.ClusterName+"/"+svc.EntryName] = true
+
+		i := -1
+		for j, esvc := range services {
+			if esvc.ClusterName == svc.ClusterName && esvc.EntryName == svc.EntryName {
+				i = j
+			}
+		}
+
+		if i == -1 {
+			// services declared without configurations get the defaults
+			var cfgs []stack.Configuration
+			if len(svc.Configurations) > 0 {
+				cfgs = es.StackConfigurations(svc.Configurations)
+			}
+
+			ssvc := stack.Service{ClusterName: svc.ClusterName, EntryName: svc.EntryName}
+			changes = append(changes, Change{Type: "service", Name: ssvc.Name(), Action: "add", apply: func(s *stack.Stack) error {
+				_, err := s.AddService(svc.ClusterName, svc.EntryName, svc.Version, cfgs)
+				return err
+			}})
+			continue
+		}
+
+		cur := current.Services[i]
+		if svc.Version == "" {
+			svc.Version = cur.Version
+		}
+		if len(svc.Configurations) == 0 {
+			svc.Configurations = cur.Configurations
+		}
+
+		cfgs := es.StackConfigurations(svc.Configurations)
+		if sameVersion(svc.Version, cur.Version) && sameConfigurations(exportConfigurations(cfgs, nil), cur.Configurations) {
+			continue
+		}
+
+		changes = append(changes, Change{Type: "service", Name: services[i].Name(), Action: "update", apply: func(s *stack.Stack) error {
+			_, err := s.ReplaceService(svc.ClusterName, svc.EntryName, svc.Version, cfgs)
+			return err
+		}})
+	}
+
+	if !prune {
+		return changes, nil
+	}
+
+	// removing a cluster also removes its node pools and
+	// services, they are listed but not removed on their own
+	prunedClusters := map[string]bool{}
+	for _, c := range clusters {
+		if !declaredClusters[c.NamePrefix+"/"+c.Provider+"/"+c.Region] {
+			prunedClusters[c.Name()] = true
+		}
+	}
+
+	for _, svc := range services {
+		if declaredServices[svc.ClusterName+"/"+svc.EntryName] {
+			continue
+		}
+		changes = append(changes, removeChange("service", svc.Name(), prunedClusters[svc.ClusterName]))
+	}
+
+	for _, np := range nodePools {
+		if declaredNodePools[np.ClusterName+"/"+np.PoolName] {
+			continue
+		}
+		changes = append(changes, removeChange("node pool", np.Name(), prunedClusters[np.ClusterName]))
+	}
+
+	for _, c := range clusters {
+		if !prunedClusters[c.Name()] {
+			continue
+		}
+		changes = append(changes, removeChange("cluster", c.Name(), false))
+	}
+
+	return changes, nil
+}
+
+// Apply makes the changes returned by Plan, in order, and
+// writes them at once, if one fails, nothing is written
+func Apply(s *stack.Stack, changes []Change) error {
+	return s.Batch(func() error {
+		for _, ch := range changes {
+			if ch.apply == nil {
+				continue
+			}
+
+			err := ch.apply(s)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func removeChange(t, name string, withCluster bool) Change {
+	ch := Change{Type: t, Name: name, Action: "remove"}
+	if !withCluster {
+		ch.apply = func(s *stack.Stack) error {
+			return s.Remove(name)
+		}
+	}
+
+	return ch
+}
+
+// sameVersion returns true if current is the desired
+// version or satisfies the desired constraint
+func sameVersion(desired, current string) bool {
+	if strings.TrimPrefix(desired, "v") == strings.TrimPrefix(current, "v") {
+		return true
+	}
+
+	c, err := util.ParseConstraint(desired)
+	if err != nil {
+		return false
+	}
+
+	return c.Check(current)
+}
+
+// sameConfigurations compares a and b by environment
+// as JSON, the same way Marshal would write them
+func sameConfigurations(a, b []Configuration) bool {
+	ja, err := json.Marshal(configurationsByKey(a))
+	if err != nil {
+		return false
+	}
+
+	jb, err := json.Marshal(configurationsByKey(b))
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(ja, jb)
+}
+
+func configurationsByKey(cfgs []Configuration) map[string]map[string]ctyJson.SimpleJSONValue {
+	m := map[string]map[string]ctyJson.SimpleJSONValue{}
+	for _, cfg := range cfgs {
+		m[cfg.EnvironmentKey] = cfg.Attributes
+	}
+
+	return m
+}
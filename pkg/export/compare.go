@@ -0,0 +1,89 @@
+package export
+
+import (
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Compare returns the differences between the stacks a and b of two
+// repositories, unlike Diff it matches clusters by provider and region,
+// ignoring their name prefix, if both stacks have exactly one cluster
+// of that provider and region, matched modules are named as in a
+func Compare(a, b Stack) []ModuleDiff {
+	return Diff(a, alignClusters(a, b))
+}
+
+// alignClusters returns b with the name prefix of each cluster
+// matched in a, including its name_prefix attribute, and the node
+// pools and services of these clusters moved to the renamed cluster
+func alignClusters(a, b Stack) Stack {
+	count := func(cs []Cluster) map[string]int {
+		n := map[string]int{}
+		for _, c := range cs {
+			n[c.Provider+"/"+c.Region]++
+		}
+
+		return n
+	}
+	aCount, bCount := count(a.Clusters), count(b.Clusters)
+
+	prefixes := map[string]string{}
+	for _, c := range a.Clusters {
+		prefixes[c.Provider+"/"+c.Region] = c.NamePrefix
+	}
+
+	renamed := map[string]string{}
+	clusters := []Cluster{}
+	for _, c := range b.Clusters {
+		k := c.Provider + "/" + c.Region
+		if aCount[k] == 1 && bCount[k] == 1 && c.NamePrefix != prefixes[k] {
+			from := stack.Cluster{NamePrefix: c.NamePrefix, Provider: c.Provider, Region: c.Region}
+			c.Configurations = renamePrefix(c.Configurations, c.NamePrefix, prefixes[k])
+			c.NamePrefix = prefixes[k]
+			to := stack.Cluster{NamePrefix: c.NamePrefix, Provider: c.Provider, Region: c.Region}
+			renamed[from.Name()] = to.Name()
+		}
+		clusters = append(clusters, c)
+	}
+	b.Clusters = clusters
+
+	nodePools := []NodePool{}
+	for _, np := range b.NodePools {
+		if n, ok := renamed[np.ClusterName]; ok {
+			np.ClusterName = n
+		}
+		nodePools = append(nodePools, np)
+	}
+	b.NodePools = nodePools
+
+	services := []Service{}
+	for _, svc := range b.Services {
+		if n, ok := renamed[svc.ClusterName]; ok {
+			svc.ClusterName = n
+		}
+		services = append(services, svc)
+	}
+	b.Services = services
+
+	return b
+}
+
+// renamePrefix returns cfgs with the name_prefix attribute
+// changed from from to to, other attributes are unchanged
+func renamePrefix(cfgs []Configuration, from, to string) []Configuration {
+	out := []Configuration{}
+	for _, cfg := range cfgs {
+		attrs := map[string]ctyJson.SimpleJSONValue{}
+		for k, v := range cfg.Attributes {
+			if k == "name_prefix" && v.Type() == cty.String && v.IsKnown() && !v.IsNull() && v.AsString() == from {
+				v = ctyJson.SimpleJSONValue{Value: cty.StringVal(to)}
+			}
+			attrs[k] = v
+		}
+
+		out = append(out, Configuration{EnvironmentKey: cfg.EnvironmentKey, Attributes: attrs})
+	}
+
+	return out
+}
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+)
+
+func TestCompare(t *testing.T) {
+	cluster := func(prefix, region string) Cluster {
+		return Cluster{
+			NamePrefix: prefix,
+			Provider:   "aws",
+			Region:     region,
+			Version:    "v0.18.1-beta.0",
+			Configurations: []Configuration{{
+				EnvironmentKey: "apps",
+				Attributes: map[string]ctyJson.SimpleJSONValue{
+					"name_prefix":      {Value: cty.StringVal(prefix)},
+					"cluster_min_size": {Value: cty.NumberIntVal(3)},
+				},
+			}},
+		}
+	}
+
+	a := Stack{
+		Environments: []Environment{{Key: "apps", IsBaseKey: true}},
+		Clusters:     []Cluster{cluster("bu1", "eu-west-1")},
+		NodePools: []NodePool{
+			{PoolName: "extra", ClusterName: "eks_bu1_eu-west-1", Version: "v0.18.1-beta.0"},
+		},
+		Services: []Service{
+			{EntryName: "nginx", ClusterName: "eks_bu1_eu-west-1", Version: "1.3.1-kbst.1"},
+		},
+	}
+
+	b := Stack{
+		Environments: []Environment{{Key: "apps", IsBaseKey: true}},
+		Clusters:     []Cluster{cluster("bu2", "eu-west-1"), cluster("bu2", "us-east-1")},
+		NodePools: []NodePool{
+			{PoolName: "extra", ClusterName: "eks_bu2_eu-west-1", Version: "v0.18.1-beta.0"},
+		},
+		Services: []Service{
+			{EntryName: "nginx", ClusterName: "eks_bu2_eu-west-1", Version: "1.4.0-kbst.0"},
+		},
+	}
+
+	assert.Equal(t, []ModuleDiff{
+		{Type: "cluster", Name: "eks_bu2_us-east-1", Change: "added", ToVersion: "v0.18.1-beta.0"},
+		{Type: "service", Name: "eks_bu1_eu-west-1_service_nginx", Change: "changed", FromVersion: "1.3.1-kbst.1", ToVersion: "1.4.0-kbst.0"},
+	}, Compare(a, b), nil)
+
+	// b is not changed
+	assert.Equal(t, "bu2", b.Clusters[0].NamePrefix, nil)
+	assert.Equal(t, "eks_bu2_eu-west-1", b.Services[0].ClusterName, nil)
+	assert.Equal(t, `"bu2"`, string(attributesJSON(b.Clusters[0].Configurations[0].Attributes)["name_prefix"]), nil)
+}
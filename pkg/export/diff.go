@@ -0,0 +1,177 @@
+package export
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/kbst/kbst/pkg/stack"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+	"golang.org/x/exp/maps"
+)
+
+// ModuleDiff is the difference of one environment,
+// cluster, node pool or service between two stacks
+type ModuleDiff struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Change      string          `json:"change"`
+	FromVersion string          `json:"from_version,omitempty"`
+	ToVersion   string          `json:"to_version,omitempty"`
+	Attributes  []AttributeDiff `json:"attributes,omitempty"`
+}
+
+// AttributeDiff is the change of a configuration attribute
+// in one environment, From or To are empty if the attribute
+// is not set on that side
+type AttributeDiff struct {
+	EnvironmentKey string          `json:"environment_key"`
+	Name           string          `json:"name"`
+	From           json.RawMessage `json:"from,omitempty"`
+	To             json.RawMessage `json:"to,omitempty"`
+}
+
+// diffModule is what Diff compares of each module
+type diffModule struct {
+	version        string
+	configurations []Configuration
+}
+
+// Diff returns the environments, clusters, node pools and services
+// added to, removed from or changed between from and to, modules
+// are compared by name, changes are versions and attributes
+func Diff(from, to Stack) (diffs []ModuleDiff) {
+	fromEnvs, toEnvs := map[string]diffModule{}, map[string]diffModule{}
+	for _, e := range from.Environments {
+		fromEnvs[e.Key] = diffModule{}
+	}
+	for _, e := range to.Environments {
+		toEnvs[e.Key] = diffModule{}
+	}
+	diffs = append(diffs, diffModules("environment", fromEnvs, toEnvs)...)
+
+	diffs = append(diffs, diffModules("cluster", clusterModules(from), clusterModules(to))...)
+	diffs = append(diffs, diffModules("node pool", nodePoolModules(from), nodePoolModules(to))...)
+	diffs = append(diffs, diffModules("service", serviceModules(from), serviceModules(to))...)
+
+	return diffs
+}
+
+func clusterModules(es Stack) map[string]diffModule {
+	ms := map[string]diffModule{}
+	for _, c := range es.Clusters {
+		sc := stack.Cluster{NamePrefix: c.NamePrefix, Provider: c.Provider, Region: c.Region}
+		ms[sc.Name()] = diffModule{c.Version, c.Configurations}
+	}
+
+	return ms
+}
+
+func nodePoolModules(es Stack) map[string]diffModule {
+	ms := map[string]diffModule{}
+	for _, np := range es.NodePools {
+		snp := stack.NodePool{ClusterName: np.ClusterName, PoolName: np.PoolName}
+		ms[snp.Name()] = diffModule{np.Version, np.Configurations}
+	}
+
+	return ms
+}
+
+func serviceModules(es Stack) map[string]diffModule {
+	ms := map[string]diffModule{}
+	for _, svc := range es.Services {
+		ssvc := stack.Service{ClusterName: svc.ClusterName, EntryName: svc.EntryName}
+		ms[ssvc.Name()] = diffModule{svc.Version, svc.Configurations}
+	}
+
+	return ms
+}
+
+// diffModules compares the modules of type t by name
+func diffModules(t string, from, to map[string]diffModule) (diffs []ModuleDiff) {
+	names := maps.Keys(from)
+	for n := range to {
+		if _, ok := from[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		fm, inFrom := from[n]
+		tm, inTo := to[n]
+
+		switch {
+		case !inFrom:
+			diffs = append(diffs, ModuleDiff{Type: t, Name: n, Change: "added", ToVersion: tm.version})
+		case !inTo:
+			diffs = append(diffs, ModuleDiff{Type: t, Name: n, Change: "removed", FromVersion: fm.version})
+		default:
+			d := ModuleDiff{Type: t, Name: n, Change: "changed"}
+			if fm.version != tm.version {
+				d.FromVersion = fm.version
+				d.ToVersion = tm.version
+			}
+			d.Attributes = diffAttributes(fm.configurations, tm.configurations)
+
+			if d.FromVersion != d.ToVersion || len(d.Attributes) > 0 {
+				diffs = append(diffs, d)
+			}
+		}
+	}
+
+	return diffs
+}
+
+// diffAttributes compares the attributes of each
+// environment, values are compared as JSON
+func diffAttributes(from, to []Configuration) (diffs []AttributeDiff) {
+	fromCfgs, toCfgs := configurationsByKey(from), configurationsByKey(to)
+
+	envs := maps.Keys(fromCfgs)
+	for k := range toCfgs {
+		if _, ok := fromCfgs[k]; !ok {
+			envs = append(envs, k)
+		}
+	}
+	sort.Strings(envs)
+
+	for _, env := range envs {
+		fromJSON, toJSON := attributesJSON(fromCfgs[env]), attributesJSON(toCfgs[env])
+
+		names := maps.Keys(fromJSON)
+		for k := range toJSON {
+			if _, ok := fromJSON[k]; !ok {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+
+		for _, n := range names {
+			if string(fromJSON[n]) == string(toJSON[n]) {
+				continue
+			}
+
+			diffs = append(diffs, AttributeDiff{
+				EnvironmentKey: env,
+				Name:           n,
+				From:           fromJSON[n],
+				To:             toJSON[n],
+			})
+		}
+	}
+
+	return diffs
+}
+
+func attributesJSON(attrs map[string]ctyJson.SimpleJSONValue) map[string]json.RawMessage {
+	out := map[string]json.RawMessage{}
+	for k, v := range attrs {
+		data, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		out[k] = data
+	}
+
+	return out
+}
@@ -0,0 +1,68 @@
+package export
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+)
+
+func TestDiff(t *testing.T) {
+	from := testStack
+	from.Services = []Service{
+		{EntryName: "nginx", ClusterName: "eks_test_eu-west-1", Version: "0.49.3-kbst.0"},
+		{EntryName: "cert-manager", ClusterName: "eks_test_eu-west-1", Version: "1.6.1-kbst.0"},
+	}
+
+	to := Stack{
+		BaseDomain:   testStack.BaseDomain,
+		Environments: []Environment{{Key: "apps", IsBaseKey: true}, {Key: "ops"}},
+		Clusters: []Cluster{
+			{
+				NamePrefix: "test",
+				Provider:   "aws",
+				Region:     "eu-west-1",
+				Version:    "v0.19.0-beta.0",
+				Configurations: []Configuration{
+					{
+						EnvironmentKey: "apps",
+						Attributes: map[string]ctyJson.SimpleJSONValue{
+							"cluster_min_size": {Value: cty.NumberIntVal(5)},
+						},
+					},
+					{
+						EnvironmentKey: "ops",
+						Attributes: map[string]ctyJson.SimpleJSONValue{
+							"cluster_min_size": {Value: cty.NumberIntVal(1)},
+						},
+					},
+				},
+			},
+		},
+		Services: []Service{
+			{EntryName: "nginx", ClusterName: "eks_test_eu-west-1", Version: "0.49.3-kbst.0"},
+		},
+	}
+
+	expected := []ModuleDiff{
+		{Type: "environment", Name: "ops", Change: "added"},
+		{
+			Type:        "cluster",
+			Name:        "eks_test_eu-west-1",
+			Change:      "changed",
+			FromVersion: "v0.18.1-beta.0",
+			ToVersion:   "v0.19.0-beta.0",
+			Attributes: []AttributeDiff{
+				{EnvironmentKey: "apps", Name: "cluster_min_size", From: json.RawMessage("3"), To: json.RawMessage("5")},
+				{EnvironmentKey: "apps", Name: "disable_default", From: json.RawMessage(`"true"`)},
+				{EnvironmentKey: "ops", Name: "cluster_min_size", To: json.RawMessage("1")},
+			},
+		},
+		{Type: "service", Name: "eks_test_eu-west-1_service_cert-manager", Change: "removed", FromVersion: "1.6.1-kbst.0"},
+	}
+
+	assert.Equal(t, expected, Diff(from, to), nil)
+	assert.Empty(t, Diff(to, to), nil)
+}
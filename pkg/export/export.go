@@ -7,34 +7,35 @@ import (
 )
 
 type Stack struct {
-	BaseDomain   string        `json:"base_domain"`
-	Environments []Environment `json:"environments"`
-	Clusters     []Cluster     `json:"clusters"`
-	NodePools    []NodePool    `json:"node_pools"`
-	Services     []Service     `json:"services"`
+	SchemaVersion int           `json:"schema_version,omitempty"`
+	BaseDomain    string        `json:"base_domain" schema:"required"`
+	Environments  []Environment `json:"environments" schema:"required"`
+	Clusters      []Cluster     `json:"clusters" schema:"required"`
+	NodePools     []NodePool    `json:"node_pools"`
+	Services      []Service     `json:"services"`
 }
 
 type Environment struct {
-	Key       string `json:"key"`
+	Key       string `json:"key" schema:"required"`
 	IsBaseKey bool   `json:"is_base_key"`
 }
 
 type Configuration struct {
-	EnvironmentKey string                             `json:"environment_key"`
+	EnvironmentKey string                             `json:"environment_key" schema:"required"`
 	Attributes     map[string]ctyJson.SimpleJSONValue `json:"attributes"`
 }
 
 type Cluster struct {
-	NamePrefix     string          `json:"name_prefix"`
-	Provider       string          `json:"provider"`
-	Region         string          `json:"region"`
+	NamePrefix     string          `json:"name_prefix" schema:"required"`
+	Provider       string          `json:"provider" schema:"required,enum=aws|azurerm|google"`
+	Region         string          `json:"region" schema:"required"`
 	Version        string          `json:"version"`
 	Configurations []Configuration `json:"configurations"`
 }
 
 type NodePool struct {
-	PoolName       string          `json:"pool_name"`
-	ClusterName    string          `json:"cluster_name"`
+	PoolName       string          `json:"pool_name" schema:"required"`
+	ClusterName    string          `json:"cluster_name" schema:"required"`
 	Provider       string          `json:"provider"`
 	Region         string          `json:"region"`
 	Version        string          `json:"version"`
@@ -42,8 +43,8 @@ type NodePool struct {
 }
 
 type Service struct {
-	EntryName      string          `json:"entry_name"`
-	ClusterName    string          `json:"cluster_name"`
+	EntryName      string          `json:"entry_name" schema:"required"`
+	ClusterName    string          `json:"cluster_name" schema:"required"`
 	Provider       string          `json:"provider"`
 	Version        string          `json:"version"`
 	Configurations []Configuration `json:"configurations"`
@@ -0,0 +1,149 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats are the formats Marshal supports
+var Formats = []string{"json", "yaml"}
+
+// FromStack builds the export of s, attributes the modules
+// reference from elsewhere, like base_domain, are left out
+// because adding the modules generates them again
+func FromStack(s *stack.Stack) (es Stack) {
+	es.SchemaVersion = SchemaVersion
+	es.BaseDomain = s.BaseDomain()
+
+	es.Environments = []Environment{}
+	for _, e := range s.Environments {
+		es.Environments = append(es.Environments, Environment{
+			Key:       e.Key,
+			IsBaseKey: e.IsBaseKey,
+		})
+	}
+
+	es.Clusters = []Cluster{}
+	for _, c := range s.Clusters() {
+		es.Clusters = append(es.Clusters, Cluster{
+			NamePrefix:     c.NamePrefix,
+			Provider:       c.Provider,
+			Region:         c.Region,
+			Version:        c.Version,
+			Configurations: exportConfigurations(c.Configurations, map[string]cty.Value{"base_domain": cty.StringVal(es.BaseDomain)}),
+		})
+	}
+
+	es.NodePools = []NodePool{}
+	for _, np := range s.NodePools() {
+		es.NodePools = append(es.NodePools, NodePool{
+			PoolName:       np.PoolName,
+			ClusterName:    np.ClusterName,
+			Provider:       np.Provider,
+			Region:         np.Region,
+			Version:        np.Version,
+			Configurations: exportConfigurations(np.Configurations, nil),
+		})
+	}
+
+	es.Services = []Service{}
+	for _, svc := range s.Services() {
+		es.Services = append(es.Services, Service{
+			EntryName:      svc.EntryName,
+			ClusterName:    svc.ClusterName,
+			Provider:       svc.Provider,
+			Version:        svc.Version,
+			Configurations: exportConfigurations(svc.Configurations, nil),
+		})
+	}
+
+	return es
+}
+
+// exportConfigurations converts in, leaving out unknown and null
+// attributes and attributes with the generated values in skip,
+// the base environment stays first, the others are sorted
+func exportConfigurations(in []stack.Configuration, skip map[string]cty.Value) []Configuration {
+	sorted := append([]stack.Configuration{}, in...)
+	if len(sorted) > 1 {
+		rest := sorted[1:]
+		sort.Slice(rest, func(i, j int) bool {
+			return rest[i].EnvironmentKey < rest[j].EnvironmentKey
+		})
+	}
+
+	cfgs := []Configuration{}
+	for _, cfg := range sorted {
+		attrs := map[string]ctyJson.SimpleJSONValue{}
+		for k, v := range cfg.Attributes {
+			if v.IsNull() || !v.IsWhollyKnown() {
+				continue
+			}
+
+			if sv, ok := skip[k]; ok && sv.RawEquals(v) {
+				continue
+			}
+
+			attrs[k] = ctyJson.SimpleJSONValue{Value: v}
+		}
+
+		cfgs = append(cfgs, Configuration{
+			EnvironmentKey: cfg.EnvironmentKey,
+			Attributes:     attrs,
+		})
+	}
+
+	return cfgs
+}
+
+// Marshal encodes es as json or yaml, yaml uses
+// the same keys as json
+func Marshal(es Stack, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(es, "", "  ")
+	if err != nil {
+		return data, err
+	}
+
+	switch format {
+	case "json":
+		return append(data, '\n'), nil
+	case "yaml":
+		// JSON is valid YAML, decoding it into a node
+		// keeps the order of the keys
+		var doc yaml.Node
+		err = yaml.Unmarshal(data, &doc)
+		if err != nil {
+			return data, err
+		}
+		blockStyle(&doc)
+
+		var b bytes.Buffer
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+
+		err = enc.Encode(&doc)
+		if err != nil {
+			return data, err
+		}
+
+		return b.Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("invalid format %q, choose one of %q", format, Formats)
+}
+
+// blockStyle resets the flow and quoting style
+// of n and its children to the encoder's default
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
@@ -0,0 +1,62 @@
+package export
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+)
+
+var testStack = Stack{
+	BaseDomain:   "kubestack.example.com",
+	Environments: []Environment{{Key: "apps", IsBaseKey: true}},
+	Clusters: []Cluster{
+		{
+			NamePrefix: "test",
+			Provider:   "aws",
+			Region:     "eu-west-1",
+			Version:    "v0.18.1-beta.0",
+			Configurations: []Configuration{
+				{
+					EnvironmentKey: "apps",
+					Attributes: map[string]ctyJson.SimpleJSONValue{
+						"cluster_min_size": {Value: cty.NumberIntVal(3)},
+						"disable_default":  {Value: cty.StringVal("true")},
+					},
+				},
+			},
+		},
+	},
+	NodePools: []NodePool{},
+	Services:  []Service{},
+}
+
+func TestMarshalYAML(t *testing.T) {
+	data, err := Marshal(testStack, "yaml")
+	assert.Equal(t, nil, err, nil)
+
+	expected := `base_domain: kubestack.example.com
+environments:
+  - key: apps
+    is_base_key: true
+clusters:
+  - name_prefix: test
+    provider: aws
+    region: eu-west-1
+    version: v0.18.1-beta.0
+    configurations:
+      - environment_key: apps
+        attributes:
+          cluster_min_size: 3
+          disable_default: "true"
+node_pools: []
+services: []
+`
+	assert.Equal(t, expected, string(data), nil)
+}
+
+func TestMarshalInvalidFormat(t *testing.T) {
+	_, err := Marshal(testStack, "toml")
+	assert.EqualError(t, err, `invalid format "toml", choose one of ["json" "yaml"]`, nil)
+}
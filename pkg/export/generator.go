@@ -0,0 +1,303 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+)
+
+// generatorStack is the format of stacks designed
+// in the generator, modules are nested by cluster
+type generatorStack struct {
+	BaseDomain      string                 `json:"base_domain"`
+	BaseEnvironment string                 `json:"base_environment"`
+	Environments    []generatorEnvironment `json:"environments"`
+	Modules         []generatorModule      `json:"modules"`
+}
+
+type generatorEnvironment struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+type generatorModule struct {
+	Type           string                   `json:"type"`
+	Provider       string                   `json:"provider"`
+	Name           *string                  `json:"name"`
+	Version        string                   `json:"version"`
+	Configurations []generatorConfiguration `json:"configurations"`
+	Children       []generatorModule        `json:"children"`
+}
+
+type generatorConfiguration struct {
+	EnvKey string                             `json:"env_key"`
+	Data   map[string]ctyJson.SimpleJSONValue `json:"data"`
+}
+
+// Unmarshal decodes data in the export format, migrated to
+// SchemaVersion, or in the format of the generator, as JSON or YAML
+func Unmarshal(data []byte) (es Stack, err error) {
+	if !json.Valid(data) {
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return es, err
+		}
+	}
+
+	var keys map[string]json.RawMessage
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return es, err
+	}
+
+	if _, ok := keys["modules"]; ok {
+		return fromGenerator(data)
+	}
+
+	data, err = migrateSchema(data)
+	if err != nil {
+		return es, err
+	}
+
+	err = json.Unmarshal(data, &es)
+	return es, err
+}
+
+// yamlToJSON converts data from YAML to JSON,
+// Marshal uses the same keys for both
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	err := yaml.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// fromGenerator converts a generator stack, modules are sorted
+// by name and attributes set by reference are left out, the
+// same way FromStack exports them
+func fromGenerator(data []byte) (es Stack, err error) {
+	gs := generatorStack{}
+	err = json.Unmarshal(data, &gs)
+	if err != nil {
+		return es, err
+	}
+
+	envNames := map[string]string{}
+	baseKey := ""
+	for _, e := range gs.Environments {
+		envNames[e.Key] = e.Name
+		if e.Key == gs.BaseEnvironment {
+			baseKey = e.Name
+		}
+	}
+
+	if baseKey == "" {
+		return es, fmt.Errorf("base environment %q not found in environments", gs.BaseEnvironment)
+	}
+
+	es.SchemaVersion = SchemaVersion
+	es.BaseDomain = gs.BaseDomain
+
+	es.Environments = []Environment{{Key: baseKey, IsBaseKey: true}}
+	others := []string{}
+	for _, name := range envNames {
+		if name != baseKey {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		es.Environments = append(es.Environments, Environment{Key: name})
+	}
+
+	es.Clusters = []Cluster{}
+	es.NodePools = []NodePool{}
+	es.Services = []Service{}
+
+	for _, m := range gs.Modules {
+		if m.Type != "cluster" {
+			return es, fmt.Errorf("unexpected top level module type %q", m.Type)
+		}
+
+		cfgs, err := generatorConfigurations(m.Configurations, envNames, baseKey)
+		if err != nil {
+			return es, err
+		}
+
+		namePrefix, err := baseString(cfgs, "name_prefix")
+		if err != nil {
+			return es, err
+		}
+
+		region, err := baseString(cfgs, "region")
+		if err != nil {
+			return es, err
+		}
+
+		// only the google cluster module has a region attribute,
+		// the other providers configure the region elsewhere
+		if m.Provider != "google" {
+			removeAttribute(cfgs, "region")
+		}
+
+		c := Cluster{
+			NamePrefix:     namePrefix,
+			Provider:       m.Provider,
+			Region:         region,
+			Version:        m.Version,
+			Configurations: cfgs,
+		}
+		es.Clusters = append(es.Clusters, c)
+
+		sc := stack.Cluster{NamePrefix: c.NamePrefix, Provider: c.Provider, Region: c.Region}
+		clusterName := sc.Name()
+
+		for _, child := range m.Children {
+			cfgs, err := generatorConfigurations(child.Configurations, envNames, baseKey)
+			if err != nil {
+				return es, err
+			}
+
+			switch child.Type {
+			case "node_pool":
+				poolName, err := baseString(cfgs, "name")
+				if err != nil {
+					poolName, err = baseString(cfgs, "node_pool_name")
+				}
+				if err != nil {
+					return es, fmt.Errorf("%s: node pool without name: %s", clusterName, err)
+				}
+
+				// generated as references to the cluster
+				removeAttribute(cfgs, "project_id")
+				removeAttribute(cfgs, "location")
+
+				// the generator joins lists the module expects
+				if c.Provider == "google" {
+					splitAttribute(cfgs, "node_locations")
+				}
+
+				es.NodePools = append(es.NodePools, NodePool{
+					PoolName:       poolName,
+					ClusterName:    clusterName,
+					Provider:       c.Provider,
+					Region:         c.Region,
+					Version:        c.Version,
+					Configurations: cfgs,
+				})
+			case "service":
+				if child.Name == nil {
+					return es, fmt.Errorf("%s: service without name", clusterName)
+				}
+
+				es.Services = append(es.Services, Service{
+					EntryName:      *child.Name,
+					ClusterName:    clusterName,
+					Provider:       child.Provider,
+					Version:        strings.TrimPrefix(child.Version, "v"),
+					Configurations: cfgs,
+				})
+			default:
+				return es, fmt.Errorf("%s: unexpected module type %q", clusterName, child.Type)
+			}
+		}
+	}
+
+	sort.Slice(es.Clusters, func(i, j int) bool {
+		ci := stack.Cluster{NamePrefix: es.Clusters[i].NamePrefix, Provider: es.Clusters[i].Provider, Region: es.Clusters[i].Region}
+		cj := stack.Cluster{NamePrefix: es.Clusters[j].NamePrefix, Provider: es.Clusters[j].Provider, Region: es.Clusters[j].Region}
+		return ci.Name() < cj.Name()
+	})
+
+	sort.Slice(es.NodePools, func(i, j int) bool {
+		npi := stack.NodePool{ClusterName: es.NodePools[i].ClusterName, PoolName: es.NodePools[i].PoolName}
+		npj := stack.NodePool{ClusterName: es.NodePools[j].ClusterName, PoolName: es.NodePools[j].PoolName}
+		return npi.Name() < npj.Name()
+	})
+
+	sort.Slice(es.Services, func(i, j int) bool {
+		si := stack.Service{ClusterName: es.Services[i].ClusterName, EntryName: es.Services[i].EntryName}
+		sj := stack.Service{ClusterName: es.Services[j].ClusterName, EntryName: es.Services[j].EntryName}
+		return si.Name() < sj.Name()
+	})
+
+	return es, nil
+}
+
+// generatorConfigurations converts in, environment keys are
+// replaced by names and null attributes, meaning inherited,
+// are left out
+func generatorConfigurations(in []generatorConfiguration, envNames map[string]string, baseKey string) ([]Configuration, error) {
+	cfgs := []stack.Configuration{}
+	for _, gc := range in {
+		name, ok := envNames[gc.EnvKey]
+		if !ok {
+			return nil, fmt.Errorf("configuration for unknown environment %q", gc.EnvKey)
+		}
+
+		attrs := map[string]cty.Value{}
+		for k, v := range gc.Data {
+			attrs[k] = v.Value
+		}
+
+		cfg := stack.Configuration{EnvironmentKey: name, Attributes: attrs}
+		if name == baseKey {
+			cfgs = append([]stack.Configuration{cfg}, cfgs...)
+			continue
+		}
+		cfgs = append(cfgs, cfg)
+	}
+
+	if len(cfgs) == 0 || cfgs[0].EnvironmentKey != baseKey {
+		return nil, fmt.Errorf("no configuration for base environment %q", baseKey)
+	}
+
+	return exportConfigurations(cfgs, nil), nil
+}
+
+// baseString returns the string attribute k
+// of the base configuration, the first one
+func baseString(cfgs []Configuration, k string) (string, error) {
+	if len(cfgs) == 0 {
+		return "", fmt.Errorf("no configurations")
+	}
+
+	v, ok := cfgs[0].Attributes[k]
+	if !ok || v.Type() != cty.String {
+		return "", fmt.Errorf("base configuration has no %s", k)
+	}
+
+	return v.AsString(), nil
+}
+
+func removeAttribute(cfgs []Configuration, k string) {
+	for _, cfg := range cfgs {
+		delete(cfg.Attributes, k)
+	}
+}
+
+// splitAttribute converts the comma separated
+// string attribute k into a list of strings
+func splitAttribute(cfgs []Configuration, k string) {
+	for _, cfg := range cfgs {
+		v, ok := cfg.Attributes[k]
+		if !ok || v.Type() != cty.String {
+			continue
+		}
+
+		l := []cty.Value{}
+		for _, e := range strings.Split(v.Value.AsString(), ",") {
+			l = append(l, cty.StringVal(e))
+		}
+		cfg.Attributes[k] = ctyJson.SimpleJSONValue{Value: cty.ListVal(l)}
+	}
+}
@@ -0,0 +1,181 @@
+package export
+
+import (
+	"fmt"
+
+	"github.com/kbst/kbst/pkg/stack"
+	"golang.org/x/exp/slices"
+)
+
+// OnConflict are the choices for modules
+// that exist in both the repository and the import
+var OnConflict = []string{"skip", "overwrite", "fail"}
+
+// Change is the action Merge or Apply takes for one module
+type Change struct {
+	Type   string
+	Name   string
+	Action string
+
+	apply func(s *stack.Stack) error
+}
+
+func (ch Change) String() string {
+	return fmt.Sprintf("%s %s: %s", ch.Type, ch.Name, ch.Action)
+}
+
+// Merge adds the clusters, node pools and services of es missing
+// from s, existing ones are skipped, overwritten or make Merge
+// fail before any change is made, depending on onConflict, all
+// changes are written at once
+func Merge(s *stack.Stack, es Stack, onConflict string) (changes []Change, err error) {
+	if !slices.Contains(OnConflict, onConflict) {
+		return changes, fmt.Errorf("invalid conflict choice %q, choose one of %q", onConflict, OnConflict)
+	}
+
+	err = mergeEnvironments(s, es)
+	if err != nil {
+		return changes, err
+	}
+
+	changes = mergePlan(s, es, onConflict)
+
+	if onConflict == "fail" {
+		conflicts := []string{}
+		for _, mc := range changes {
+			if mc.Action == "conflict" {
+				conflicts = append(conflicts, mc.Name)
+			}
+		}
+
+		if len(conflicts) > 0 {
+			return changes, fmt.Errorf("modules already exist: %q", conflicts)
+		}
+	}
+
+	// all changes are written at once, if one
+	// fails, the repository is left unchanged
+	err = s.Batch(func() error {
+		i := 0
+		for _, c := range es.Clusters {
+			mc := changes[i]
+			i++
+
+			cfgs := es.StackConfigurations(c.Configurations)
+			switch mc.Action {
+			case "add":
+				_, err = s.AddCluster(c.NamePrefix, c.Provider, c.Region, c.Version, cfgs)
+			case "overwrite":
+				_, err = s.ReplaceCluster(c.NamePrefix, c.Provider, c.Region, c.Version, cfgs)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, np := range es.NodePools {
+			mc := changes[i]
+			i++
+
+			cfgs := es.StackConfigurations(np.Configurations)
+			switch mc.Action {
+			case "add":
+				_, err = s.AddNodePool(np.ClusterName, np.PoolName, cfgs)
+			case "overwrite":
+				_, err = s.ReplaceNodePool(np.ClusterName, np.PoolName, cfgs)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, svc := range es.Services {
+			mc := changes[i]
+			i++
+
+			// services exported without configurations get the defaults
+			var cfgs []stack.Configuration
+			if len(svc.Configurations) > 0 {
+				cfgs = es.StackConfigurations(svc.Configurations)
+			}
+
+			switch mc.Action {
+			case "add":
+				_, err = s.AddService(svc.ClusterName, svc.EntryName, svc.Version, cfgs)
+			case "overwrite":
+				_, err = s.ReplaceService(svc.ClusterName, svc.EntryName, svc.Version, cfgs)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return changes, err
+}
+
+// mergeEnvironments returns an error if es uses environments
+// s does not have, Merge can not add environments
+func mergeEnvironments(s *stack.Stack, es Stack) error {
+	for _, e := range es.Environments {
+		found := false
+		for _, se := range s.Environments {
+			if se.Key == e.Key && se.IsBaseKey == e.IsBaseKey {
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("environment %q does not match the environments of the repository", e.Key)
+		}
+	}
+
+	return nil
+}
+
+// mergePlan returns the action for each module of es, in the
+// order of the clusters, node pools and services of es
+func mergePlan(s *stack.Stack, es Stack, onConflict string) (changes []Change) {
+	action := func(exists bool) string {
+		if !exists {
+			return "add"
+		}
+
+		if onConflict == "fail" {
+			return "conflict"
+		}
+
+		return onConflict
+	}
+
+	clusters := map[string]bool{}
+	for _, c := range s.Clusters() {
+		clusters[c.NamePrefix+"/"+c.Provider+"/"+c.Region] = true
+	}
+	for _, c := range es.Clusters {
+		sc := stack.Cluster{NamePrefix: c.NamePrefix, Provider: c.Provider, Region: c.Region}
+		changes = append(changes, Change{Type: "cluster", Name: sc.Name(), Action: action(clusters[c.NamePrefix+"/"+c.Provider+"/"+c.Region])})
+	}
+
+	nodePools := map[string]bool{}
+	for _, np := range s.NodePools() {
+		nodePools[np.ClusterName+"/"+np.PoolName] = true
+	}
+	for _, np := range es.NodePools {
+		snp := stack.NodePool{ClusterName: np.ClusterName, PoolName: np.PoolName}
+		changes = append(changes, Change{Type: "node pool", Name: snp.Name(), Action: action(nodePools[np.ClusterName+"/"+np.PoolName])})
+	}
+
+	services := map[string]bool{}
+	for _, svc := range s.Services() {
+		services[svc.ClusterName+"/"+svc.EntryName] = true
+	}
+	for _, svc := range es.Services {
+		ssvc := stack.Service{ClusterName: svc.ClusterName, EntryName: svc.EntryName}
+		changes = append(changes, Change{Type: "service", Name: ssvc.Name(), Action: action(services[svc.ClusterName+"/"+svc.EntryName])})
+	}
+
+	return changes
+}
@@ -0,0 +1,53 @@
+package export
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/kbst/kbst/pkg/stack"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStackFromFixture(t *testing.T, n string) (*stack.Stack, string) {
+	p, err := os.MkdirTemp("", "kbst-unit-test-*")
+	assert.Equal(t, nil, err, nil)
+
+	out, err := exec.Command("cp", "-r", filepath.Join("..", "stack", "test_fixtures", n)+"/.", p).CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	cj := util.CliJSON{}
+	err = cj.Load(util.CachedDownloader{})
+	assert.Equal(t, nil, err, nil)
+
+	s := stack.NewStack(tfhcl.NewRoot(p), cj)
+	err = s.FromPath()
+	assert.Equal(t, nil, err, nil)
+
+	return s, p
+}
+
+func TestMergeFailureWritesNothing(t *testing.T) {
+	s, p := newTestStackFromFixture(t, "kubestack-starter-eks-3envs")
+	defer os.RemoveAll(p)
+
+	cluster := s.Clusters()[0].Name()
+	services := len(s.Services())
+
+	// the second service fails, after the first was added
+	es := Stack{
+		Services: []Service{
+			{EntryName: "sealed-secrets", ClusterName: cluster},
+			{EntryName: "sealed-secrets", ClusterName: "missing_cluster"},
+		},
+	}
+
+	_, err := Merge(s, es, "fail")
+	assert.EqualError(t, err, `no cluster named "missing_cluster" found`, nil)
+
+	assert.NoFileExists(t, filepath.Join(p, cluster+"_service_sealed-secrets.tf"), nil)
+	assert.Len(t, s.Services(), services, nil)
+}
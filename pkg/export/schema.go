@@ -0,0 +1,134 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+)
+
+// SchemaVersion is the version of the format Marshal writes,
+// bump it and add a migration when the format changes
+const SchemaVersion = 1
+
+// schemaMigrations migrate documents to the next schema
+// version, the migration at index i migrates version i
+var schemaMigrations = []func(doc map[string]interface{}) error{
+	// documents written before schema_version existed
+	// have the same format as version 1
+	func(doc map[string]interface{}) error { return nil },
+}
+
+// migrateSchema migrates the document data to SchemaVersion,
+// documents without schema_version are version 0
+func migrateSchema(data []byte) ([]byte, error) {
+	doc := map[string]interface{}{}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if v, ok := doc["schema_version"]; ok {
+		f, ok := v.(float64)
+		if !ok || f != float64(int(f)) || f < 0 {
+			return nil, fmt.Errorf("invalid schema_version %v", v)
+		}
+		version = int(f)
+	}
+
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("schema_version %d is newer than the supported %d, upgrade kbst", version, SchemaVersion)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		err = schemaMigrations[version](doc)
+		if err != nil {
+			return nil, fmt.Errorf("migrating schema_version %d: %s", version, err)
+		}
+	}
+	doc["schema_version"] = SchemaVersion
+
+	return json.Marshal(doc)
+}
+
+// JSONSchema returns a JSON Schema document of the export format,
+// the schema tag of fields lists options, required makes the field
+// required and enum=a|b restricts it to the values a and b
+func JSONSchema() ([]byte, error) {
+	s := typeSchema(reflect.TypeOf(Stack{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "kbst export"
+	s["description"] = fmt.Sprintf("Clusters, node pools and services of a Kubestack repository, schema version %d.", SchemaVersion)
+
+	props := s["properties"].(map[string]interface{})
+	props["schema_version"] = map[string]interface{}{
+		"type":    "integer",
+		"minimum": 0,
+		"maximum": SchemaVersion,
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return data, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// typeSchema returns the schema of t, configuration
+// attribute values can be any JSON value
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(ctyJson.SimpleJSONValue{}) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+
+			fs := typeSchema(f.Type)
+			for _, opt := range strings.Split(f.Tag.Get("schema"), ",") {
+				switch {
+				case opt == "required":
+					required = append(required, name)
+				case strings.HasPrefix(opt, "enum="):
+					fs["enum"] = strings.Split(strings.TrimPrefix(opt, "enum="), "|")
+				}
+			}
+			props[name] = fs
+		}
+
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           props,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer"}
+	}
+
+	return map[string]interface{}{"type": "string"}
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalSchemaVersion(t *testing.T) {
+	// documents without schema_version are migrated
+	es, err := Unmarshal([]byte(`{"base_domain": "kubestack.example.com", "environments": [], "clusters": []}`))
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, SchemaVersion, es.SchemaVersion, nil)
+	assert.Equal(t, "kubestack.example.com", es.BaseDomain, nil)
+
+	_, err = Unmarshal([]byte(`{"schema_version": 99, "base_domain": "kubestack.example.com"}`))
+	assert.EqualError(t, err, "schema_version 99 is newer than the supported 1, upgrade kbst", nil)
+
+	_, err = Unmarshal([]byte(`schema_version: "one"`))
+	assert.EqualError(t, err, "invalid schema_version one", nil)
+}
+
+func TestMarshalSchemaVersion(t *testing.T) {
+	es := testStack
+	es.SchemaVersion = SchemaVersion
+
+	data, err := Marshal(es, "json")
+	assert.Equal(t, nil, err, nil)
+
+	rt, err := Unmarshal(data)
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, SchemaVersion, rt.SchemaVersion, nil)
+
+	again, err := Marshal(rt, "json")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, string(data), string(again), nil)
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := JSONSchema()
+	assert.Equal(t, nil, err, nil)
+
+	var s struct {
+		Required   []string `json:"required"`
+		Properties struct {
+			SchemaVersion struct {
+				Maximum int `json:"maximum"`
+			} `json:"schema_version"`
+			Clusters struct {
+				Items struct {
+					Required   []string `json:"required"`
+					Properties struct {
+						Provider struct {
+							Enum []string `json:"enum"`
+						} `json:"provider"`
+					} `json:"properties"`
+				} `json:"items"`
+			} `json:"clusters"`
+		} `json:"properties"`
+	}
+	err = json.Unmarshal(data, &s)
+	assert.Equal(t, nil, err, nil)
+
+	assert.Equal(t, []string{"base_domain", "environments", "clusters"}, s.Required, nil)
+	assert.Equal(t, SchemaVersion, s.Properties.SchemaVersion.Maximum, nil)
+	assert.Equal(t, []string{"name_prefix", "provider", "region"}, s.Properties.Clusters.Items.Required, nil)
+	assert.Equal(t, []string{"aws", "azurerm", "google"}, s.Properties.Clusters.Items.Properties.Provider.Enum, nil)
+}
@@ -10,6 +10,14 @@ import (
 	"golang.org/x/exp/slices"
 )
 
+// NodeShape is the instance type and autoscaling range
+// of a cluster's default node pool or of a node pool
+type NodeShape struct {
+	InstanceType string
+	MinNodes     int64
+	MaxNodes     int64
+}
+
 type Cluster struct {
 	mod            *tfhcl.Module
 	NamePrefix     string
@@ -81,6 +89,24 @@ func (c *Cluster) Validate(cj util.CliJSON) error {
 	return nil
 }
 
+func (c *Cluster) NodeShape(env string) (ns NodeShape, err error) {
+	attrs, err := effectiveAttributes(c.Configurations, env)
+	if err != nil {
+		return ns, err
+	}
+
+	switch c.Provider {
+	case "aws":
+		ns = nodeShape(attrs, "cluster_instance_type", "cluster_min_size", "cluster_max_size")
+	case "azurerm":
+		ns = nodeShape(attrs, "default_node_pool_vm_size", "default_node_pool_min_count", "default_node_pool_max_count")
+	case "google":
+		ns = nodeShape(attrs, "cluster_machine_type", "cluster_min_node_count", "cluster_max_node_count")
+	}
+
+	return ns, nil
+}
+
 func (c *Cluster) ToHCL() map[string][]byte {
 	files := make(map[string][]byte)
 
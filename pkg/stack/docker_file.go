@@ -51,3 +51,25 @@ func dockerfile(in []byte, clusters []Cluster) []byte {
 
 	return out
 }
+
+// dockerfileVersion sets the tag version of kubestack/framework
+// images to version, keeping any suffix like -eks or -kind
+func dockerfileVersion(in []byte, version string) []byte {
+	re := regexp.MustCompile(`^FROM (\S*kubestack/framework):(v\d+\.\d+\.\d+(?:-\w*\.\d+)?)(.*)$`)
+	sc := bufio.NewScanner(bytes.NewReader(in))
+
+	out := []byte{}
+	for sc.Scan() {
+		line := sc.Text()
+
+		// FROM kubestack/framework:v0.18.0-beta.0-eks => ["kubestack/framework", "v0.18.0-beta.0", "-eks"]
+		sm := re.FindStringSubmatch(line)
+		if sm != nil {
+			line = fmt.Sprintf("FROM %s:%s%s", sm[1], version, sm[3])
+		}
+
+		out = append(out, []byte(fmt.Sprintln(line))...)
+	}
+
+	return out
+}
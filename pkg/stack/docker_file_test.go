@@ -117,3 +117,18 @@ func TestDockerfileCorrectSingle(t *testing.T) {
 
 	assert.Equal(t, string(exp), string(dockerfile(in, cls)))
 }
+
+func TestDockerfileVersion(t *testing.T) {
+	cases := map[string]string{
+		"FROM kubestack/framework:v0.18.0-beta.0":              "FROM kubestack/framework:v0.18.2-beta.0\n",
+		"FROM kubestack/framework:v0.18.0-beta.0-eks":          "FROM kubestack/framework:v0.18.2-beta.0-eks\n",
+		"FROM kubestack/framework:v0.18.0-beta.0-kind":         "FROM kubestack/framework:v0.18.2-beta.0-kind\n",
+		"FROM ghcr.io/kubestack/framework:v0.17.0-beta.0-gke":  "FROM ghcr.io/kubestack/framework:v0.18.2-beta.0-gke\n",
+		"FROM kubestack/framework:v0.18.0-beta.0-aks AS infra": "FROM kubestack/framework:v0.18.2-beta.0-aks AS infra\n",
+		"FROM golang:v1.19.0":                                  "FROM golang:v1.19.0\n",
+	}
+
+	for in, exp := range cases {
+		assert.Equal(t, exp, string(dockerfileVersion([]byte(in), "v0.18.2-beta.0")), in)
+	}
+}
@@ -0,0 +1,341 @@
+package stack
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+type GraphNode struct {
+	ID      string
+	Kind    string
+	Name    string
+	Cluster string
+	Details []string
+}
+
+type GraphEdge struct {
+	From string
+	To   string
+}
+
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+func (s *Stack) Graph(env string) (g Graph, err error) {
+	if env != "" {
+		var envOptions []string
+		for _, e := range s.Environments {
+			envOptions = append(envOptions, e.Key)
+		}
+
+		if !slices.Contains(envOptions, env) {
+			return g, fmt.Errorf("invalid environment %q, choose one of %q", env, envOptions)
+		}
+	}
+
+	clusters := s.Clusters()
+	refs := map[string]*tfhcl.Module{}
+
+	for i := range clusters {
+		c := clusters[i]
+		n := GraphNode{
+			ID:      moduleAddress(c.Name()),
+			Kind:    "cluster",
+			Name:    c.Name(),
+			Cluster: c.Name(),
+			Details: []string{fmt.Sprintf("cluster %s %s", c.Provider, c.Version)},
+		}
+
+		if env != "" {
+			ns, err := c.NodeShape(env)
+			if err != nil {
+				return g, err
+			}
+			n.Details = append(n.Details, ns.describe(env))
+		}
+
+		g.addNode(n)
+		refs[n.ID] = c.mod
+	}
+
+	for _, np := range s.NodePools() {
+		n := GraphNode{
+			ID:      moduleAddress(np.Name()),
+			Kind:    "node-pool",
+			Name:    np.Name(),
+			Cluster: np.ClusterName,
+			Details: []string{fmt.Sprintf("node-pool %s %s", np.PoolName, np.Version)},
+		}
+
+		if env != "" {
+			ns, err := np.NodeShape(env)
+			if err != nil {
+				return g, err
+			}
+			n.Details = append(n.Details, ns.describe(env))
+		}
+
+		g.addNode(n)
+		refs[n.ID] = np.mod
+	}
+
+	for _, svc := range s.Services() {
+		n := GraphNode{
+			ID:      moduleAddress(svc.Name()),
+			Kind:    "service",
+			Name:    svc.Name(),
+			Cluster: svc.ClusterName,
+			Details: []string{fmt.Sprintf("service %s %s", svc.EntryName, svc.Version)},
+		}
+
+		g.addNode(n)
+		refs[n.ID] = svc.mod
+	}
+
+	// custom modules and framework modules
+	// that are not clusters, node pools or services
+	for _, mods := range s.root.Modules {
+		for i := range mods {
+			m := mods[i]
+			id := moduleAddress(m.Name)
+			if _, ok := refs[id]; ok {
+				continue
+			}
+
+			n := GraphNode{
+				ID:      id,
+				Kind:    "module",
+				Name:    m.Name,
+				Cluster: graphCluster(m.Name, clusters),
+				Details: []string{fmt.Sprintf("module %s", m.Source)},
+			}
+
+			if t, p, v, err := m.TypeProviderVersion(); err == nil {
+				n.Kind = t
+				n.Details = []string{fmt.Sprintf("%s %s %s", t, p, v)}
+			}
+
+			if pc, err := m.ParentCluster(); err == nil {
+				n.Cluster = pc
+			}
+
+			g.addNode(n)
+			refs[id] = &m
+		}
+	}
+
+	for fn, ps := range s.root.Providers {
+		for _, p := range ps {
+			c := graphCluster(p.Alias, clusters)
+			if c == "" {
+				c = graphCluster(strings.TrimSuffix(filepath.Base(fn), ".tf"), clusters)
+			}
+
+			g.addNode(GraphNode{
+				ID:      p.Address(),
+				Kind:    "provider",
+				Name:    p.Address(),
+				Cluster: c,
+				Details: []string{"provider"},
+			})
+
+			for _, mn := range p.References() {
+				g.Edges = append(g.Edges, GraphEdge{From: p.Address(), To: moduleAddress(mn)})
+			}
+		}
+	}
+
+	for id, m := range refs {
+		for _, mn := range m.References() {
+			g.Edges = append(g.Edges, GraphEdge{From: id, To: moduleAddress(mn)})
+		}
+
+		for _, p := range m.Providers {
+			g.Edges = append(g.Edges, GraphEdge{From: id, To: p.Address()})
+		}
+	}
+
+	g.normalize()
+
+	return g, nil
+}
+
+func (g *Graph) addNode(n GraphNode) {
+	for _, en := range g.Nodes {
+		if en.ID == n.ID {
+			return
+		}
+	}
+
+	g.Nodes = append(g.Nodes, n)
+}
+
+// normalize sorts nodes and edges and drops edges
+// that are duplicates or point to unknown nodes
+func (g *Graph) normalize() {
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+
+	ids := map[string]bool{}
+	for _, n := range g.Nodes {
+		ids[n.ID] = true
+	}
+
+	edges := []GraphEdge{}
+	for _, e := range g.Edges {
+		if !ids[e.From] || !ids[e.To] || e.From == e.To {
+			continue
+		}
+
+		if !slices.Contains(edges, e) {
+			edges = append(edges, e)
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From == edges[j].From {
+			return edges[i].To < edges[j].To
+		}
+		return edges[i].From < edges[j].From
+	})
+
+	g.Edges = edges
+}
+
+// clusters returns the nodes grouped by cluster name,
+// nodes not belonging to any cluster use the empty key
+func (g *Graph) clusters() (keys []string, groups map[string][]GraphNode) {
+	groups = map[string][]GraphNode{}
+	for _, n := range g.Nodes {
+		groups[n.Cluster] = append(groups[n.Cluster], n)
+	}
+
+	keys = maps.Keys(groups)
+	sort.Strings(keys)
+
+	return keys, groups
+}
+
+func (g *Graph) DOT() string {
+	var b strings.Builder
+
+	b.WriteString("digraph stack {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+
+	keys, groups := g.clusters()
+	for _, k := range keys {
+		indent := "  "
+		if k != "" {
+			fmt.Fprintf(&b, "\n  subgraph %s {\n", dotQuote(fmt.Sprintf("cluster_%s", k)))
+			fmt.Fprintf(&b, "    label=%s;\n", dotQuote(k))
+			indent = "    "
+		}
+
+		for _, n := range groups[k] {
+			attrs := fmt.Sprintf("label=%s", dotQuote(n.label("\n")))
+			if n.Kind == "provider" {
+				attrs = fmt.Sprintf("%s, shape=ellipse", attrs)
+			}
+			fmt.Fprintf(&b, "%s%s [%s];\n", indent, dotQuote(n.ID), attrs)
+		}
+
+		if k != "" {
+			b.WriteString("  }\n")
+		}
+	}
+
+	if len(g.Edges) > 0 {
+		b.WriteString("\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(e.From), dotQuote(e.To))
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+func (g *Graph) Mermaid() string {
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+
+	keys, groups := g.clusters()
+	for _, k := range keys {
+		indent := "  "
+		if k != "" {
+			fmt.Fprintf(&b, "  subgraph %s [%s]\n", mermaidID(fmt.Sprintf("cluster_%s", k)), mermaidQuote(k))
+			indent = "    "
+		}
+
+		for _, n := range groups[k] {
+			l := mermaidQuote(n.label("<br/>"))
+			if n.Kind == "provider" {
+				fmt.Fprintf(&b, "%s%s{{%s}}\n", indent, mermaidID(n.ID), l)
+				continue
+			}
+			fmt.Fprintf(&b, "%s%s[%s]\n", indent, mermaidID(n.ID), l)
+		}
+
+		if k != "" {
+			b.WriteString("  end\n")
+		}
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s --> %s\n", mermaidID(e.From), mermaidID(e.To))
+	}
+
+	return b.String()
+}
+
+func (n *GraphNode) label(sep string) string {
+	return strings.Join(append([]string{n.Name}, n.Details...), sep)
+}
+
+func (ns NodeShape) describe(env string) string {
+	return fmt.Sprintf("%s: %s, %d-%d nodes", env, ns.InstanceType, ns.MinNodes, ns.MaxNodes)
+}
+
+func moduleAddress(name string) string {
+	return fmt.Sprintf("module.%s", name)
+}
+
+// graphCluster returns the name of the cluster name
+// is prefixed with or equal to, or the empty string
+func graphCluster(name string, clusters []Cluster) string {
+	for _, c := range clusters {
+		if name == c.Name() || strings.HasPrefix(name, fmt.Sprintf("%s_", c.Name())) {
+			return c.Name()
+		}
+	}
+
+	return ""
+}
+
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return fmt.Sprintf("\"%s\"", r.Replace(s))
+}
+
+var mermaidIDRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func mermaidID(s string) string {
+	return mermaidIDRe.ReplaceAllString(s, "_")
+}
+
+func mermaidQuote(s string) string {
+	return fmt.Sprintf("\"%s\"", strings.ReplaceAll(s, `"`, "#quot;"))
+}
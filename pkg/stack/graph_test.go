@@ -0,0 +1,143 @@
+package stack
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphMulti4Envs(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-multi-4envs")
+	assert.Equal(t, nil, err, nil)
+
+	g, err := s.Graph("")
+	assert.Equal(t, nil, err, nil)
+
+	// 3 clusters, 3 node pools, 9 services, 7 providers
+	assert.Len(t, g.Nodes, 22, nil)
+
+	assert.Contains(t, g.Edges, GraphEdge{
+		From: "module.eks_gc0_eu-west-1_node_pool_extra",
+		To:   "module.eks_gc0_eu-west-1",
+	}, nil)
+	assert.Contains(t, g.Edges, GraphEdge{
+		From: "module.eks_gc0_eu-west-1_node_pool_extra",
+		To:   "aws.eks_gc0_eu-west-1",
+	}, nil)
+	assert.Contains(t, g.Edges, GraphEdge{
+		From: "module.aks_gc0_westeurope_service_nginx",
+		To:   "kustomization.aks_gc0_westeurope",
+	}, nil)
+	assert.Contains(t, g.Edges, GraphEdge{
+		From: "kustomization.gke_gc0_europe-west1",
+		To:   "module.gke_gc0_europe-west1",
+	}, nil)
+
+	for _, n := range g.Nodes {
+		assert.NotEqual(t, "", n.Cluster, n.ID)
+	}
+
+	os.RemoveAll(p)
+}
+
+func TestGraphELBDNS(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-eks-3envs")
+	assert.Equal(t, nil, err, nil)
+
+	g, err := s.Graph("")
+	assert.Equal(t, nil, err, nil)
+
+	var found bool
+	for _, n := range g.Nodes {
+		if n.ID == "module.eks_gc0_eu-west-1_dns_zone" {
+			found = true
+			assert.Equal(t, "elb-dns", n.Kind, nil)
+			assert.Equal(t, "eks_gc0_eu-west-1", n.Cluster, nil)
+		}
+	}
+	assert.True(t, found, nil)
+
+	assert.Contains(t, g.Edges, GraphEdge{
+		From: "module.eks_gc0_eu-west-1_dns_zone",
+		To:   "module.eks_gc0_eu-west-1",
+	}, nil)
+
+	os.RemoveAll(p)
+}
+
+func TestGraphEnvironment(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-multi-4envs")
+	assert.Equal(t, nil, err, nil)
+
+	g, err := s.Graph("apps-dev")
+	assert.Equal(t, nil, err, nil)
+
+	for _, n := range g.Nodes {
+		if n.ID == "module.eks_gc0_eu-west-1" {
+			assert.Equal(t, []string{
+				"cluster aws v0.18.1-beta.0",
+				"apps-dev: t3a.xlarge, 3-9 nodes",
+			}, n.Details, nil)
+		}
+	}
+
+	_, err = s.Graph("no-such-env")
+	assert.EqualError(t, err, "invalid environment \"no-such-env\", choose one of [\"apps-prd\" \"apps-dev\" \"apps-stg\" \"ops\"]", nil)
+
+	os.RemoveAll(p)
+}
+
+func TestGraphDOT(t *testing.T) {
+	g := Graph{
+		Nodes: []GraphNode{
+			{ID: "module.test_cluster", Kind: "cluster", Name: "test_cluster", Cluster: "test_cluster", Details: []string{"cluster aws v0"}},
+			{ID: "kustomization.test_cluster", Kind: "provider", Name: "kustomization.test_cluster", Cluster: "test_cluster", Details: []string{"provider"}},
+			{ID: "module.custom", Kind: "module", Name: "custom", Details: []string{"module \"./custom\""}},
+		},
+		Edges: []GraphEdge{
+			{From: "kustomization.test_cluster", To: "module.test_cluster"},
+		},
+	}
+
+	exp := `digraph stack {
+  rankdir=LR;
+  node [shape=box];
+  "module.custom" [label="custom\nmodule \"./custom\""];
+
+  subgraph "cluster_test_cluster" {
+    label="test_cluster";
+    "module.test_cluster" [label="test_cluster\ncluster aws v0"];
+    "kustomization.test_cluster" [label="kustomization.test_cluster\nprovider", shape=ellipse];
+  }
+
+  "kustomization.test_cluster" -> "module.test_cluster";
+}
+`
+
+	assert.Equal(t, exp, g.DOT(), nil)
+}
+
+func TestGraphMermaid(t *testing.T) {
+	g := Graph{
+		Nodes: []GraphNode{
+			{ID: "module.test_cluster", Kind: "cluster", Name: "test_cluster", Cluster: "test_cluster", Details: []string{"cluster aws v0"}},
+			{ID: "kustomization.test_cluster", Kind: "provider", Name: "kustomization.test_cluster", Cluster: "test_cluster", Details: []string{"provider"}},
+			{ID: "module.custom", Kind: "module", Name: "custom", Details: []string{"module \"./custom\""}},
+		},
+		Edges: []GraphEdge{
+			{From: "kustomization.test_cluster", To: "module.test_cluster"},
+		},
+	}
+
+	exp := `flowchart LR
+  module_custom["custom<br/>module #quot;./custom#quot;"]
+  subgraph cluster_test_cluster ["test_cluster"]
+    module_test_cluster["test_cluster<br/>cluster aws v0"]
+    kustomization_test_cluster{{"kustomization.test_cluster<br/>provider"}}
+  end
+  kustomization_test_cluster --> module_test_cluster
+`
+
+	assert.Equal(t, exp, g.Mermaid(), nil)
+}
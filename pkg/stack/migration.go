@@ -0,0 +1,396 @@
+package stack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/mod/semver"
+)
+
+// Migration describes the configuration changes a framework
+// release requires from cluster or node pool modules
+type Migration struct {
+	// From and To are the framework version range of the
+	// migration, it applies to updates from at or above From,
+	// and below To, to To or above, an empty From matches
+	// all earlier releases, To is the release requiring it
+	From string
+	To   string
+
+	// Type is cluster or node-pool
+	Type string
+
+	// Provider is aws, azurerm or google, empty matches all
+	Provider string
+
+	// Renames maps old to new attribute names
+	Renames map[string]string
+
+	// Removals are attributes no longer supported
+	Removals []string
+
+	// Defaults are the previous defaults of attributes whose
+	// default changed, they are pinned in the base environment
+	// if the attribute is not set there
+	Defaults map[string]cty.Value
+
+	// Sources maps old to new module paths, e.g.
+	// aws/cluster to aws/cluster-v2
+	Sources map[string]string
+}
+
+// migrations is the registry of framework migrations,
+// new entries are added with the releases requiring them
+var migrations = []Migration{}
+
+// Changes describes the changes of m, one per line
+func (m Migration) Changes() (changes []string) {
+	for _, from := range sortedKeys(m.Renames) {
+		changes = append(changes, fmt.Sprintf("rename %s to %s", from, m.Renames[from]))
+	}
+
+	for _, a := range m.Removals {
+		changes = append(changes, fmt.Sprintf("remove %s", a))
+	}
+
+	for _, a := range sortedKeys(m.Defaults) {
+		changes = append(changes, fmt.Sprintf("pin previous default of %s", a))
+	}
+
+	for _, from := range sortedKeys(m.Sources) {
+		changes = append(changes, fmt.Sprintf("change source %s to %s", from, m.Sources[from]))
+	}
+
+	return changes
+}
+
+func (m Migration) matches(t, p, from, to string) bool {
+	if m.Type != strings.ReplaceAll(t, "_", "-") {
+		return false
+	}
+
+	if m.Provider != "" && m.Provider != p {
+		return false
+	}
+
+	if m.From != "" && semver.Compare(from, util.CanonicalVersion(m.From)) < 0 {
+		return false
+	}
+
+	v := util.CanonicalVersion(m.To)
+	return semver.Compare(from, v) < 0 && semver.Compare(to, v) >= 0
+}
+
+// migrationsFor returns the migrations between from and to
+// for modules of type t and provider p, oldest first
+func migrationsFor(t, p, from, to string) (ms []Migration) {
+	for _, m := range migrations {
+		if m.matches(t, p, from, to) {
+			ms = append(ms, m)
+		}
+	}
+
+	sort.SliceStable(ms, func(i, j int) bool {
+		return semver.Compare(util.CanonicalVersion(ms[i].To), util.CanonicalVersion(ms[j].To)) < 0
+	})
+
+	return ms
+}
+
+// setModuleSource applies the source path changes of ms to the
+// source attribute of b, the ref is kept as is
+func setModuleSource(b *hclwrite.Block, ms []Migration) {
+	attr := b.Body().GetAttribute("source")
+	if attr == nil {
+		return
+	}
+
+	src := strings.Trim(strings.TrimSpace(string(attr.Expr().BuildTokens(nil).Bytes())), `"`)
+	parts := strings.SplitN(src, "//", 2)
+	if len(parts) != 2 {
+		return
+	}
+
+	path, ref, _ := strings.Cut(parts[1], "?")
+	changed := false
+	for _, m := range ms {
+		if np, ok := m.Sources[path]; ok {
+			path = np
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	nsrc := fmt.Sprintf("%s//%s", parts[0], path)
+	if ref != "" {
+		nsrc = fmt.Sprintf("%s?%s", nsrc, ref)
+	}
+
+	b.Body().SetAttributeValue("source", cty.StringVal(nsrc))
+}
+
+type sourceEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// migrateConfigurations applies the attribute changes of the
+// migrations in toMigrate, keyed by module name, to the
+// configuration attributes of the modules in src, unchanged
+// parts, including references like var.base_domain, are kept
+func migrateConfigurations(src []byte, fn string, toMigrate map[string][]Migration, baseKeys map[string]string) ([]byte, error) {
+	if len(toMigrate) == 0 {
+		return src, nil
+	}
+
+	f, diags := hclsyntax.ParseConfig(src, fn, hcl.InitialPos)
+	if diags.HasErrors() {
+		return src, diags
+	}
+
+	body, ok := f.Body.(*hclsyntax.Body)
+	if !ok {
+		return src, nil
+	}
+
+	edits := []sourceEdit{}
+	for _, b := range body.Blocks {
+		if b.Type != "module" || len(b.Labels) != 1 {
+			continue
+		}
+
+		ms, ok := toMigrate[b.Labels[0]]
+		if !ok {
+			continue
+		}
+
+		attr, ok := b.Body.Attributes["configuration"]
+		if !ok {
+			continue
+		}
+
+		cfg, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+		if !ok {
+			return src, fmt.Errorf("%s: configuration is not an object", b.Labels[0])
+		}
+
+		baseKey := baseKeys[b.Labels[0]]
+		if baseKey == "" {
+			baseKey = "apps"
+		}
+
+		for _, env := range cfg.Items {
+			envKey, err := objectKey(env.KeyExpr)
+			if err != nil {
+				return src, fmt.Errorf("%s: %s", b.Labels[0], err)
+			}
+
+			attrs, ok := env.ValueExpr.(*hclsyntax.ObjectConsExpr)
+			if !ok {
+				continue
+			}
+
+			ee, err := migrateEnvironment(src, attrs, ms, envKey == baseKey)
+			if err != nil {
+				return src, fmt.Errorf("%s: %s: %s", b.Labels[0], envKey, err)
+			}
+			edits = append(edits, ee...)
+		}
+	}
+
+	if len(edits) == 0 {
+		return src, nil
+	}
+
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+
+	out := append([]byte{}, src...)
+	for _, e := range edits {
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+	}
+
+	return hclwrite.Format(out), nil
+}
+
+// migrateEnvironment returns the edits applying ms to the
+// attributes of one environment, defaults are only pinned
+// if isBase is true
+func migrateEnvironment(src []byte, attrs *hclsyntax.ObjectConsExpr, ms []Migration, isBase bool) (edits []sourceEdit, err error) {
+	names := map[string]hclsyntax.ObjectConsItem{}
+	for _, item := range attrs.Items {
+		k, err := objectKey(item.KeyExpr)
+		if err != nil {
+			return edits, err
+		}
+		names[k] = item
+	}
+
+	// current tracks the names after earlier migrations,
+	// so later migrations can build on them
+	current := map[string]string{}
+	for k := range names {
+		current[k] = k
+	}
+
+	removed := map[string]bool{}
+	pinned := []string{}
+	pinnedValues := map[string]cty.Value{}
+	for _, m := range ms {
+		for _, from := range sortedKeys(m.Renames) {
+			to := m.Renames[from]
+
+			orig, ok := originalName(current, from)
+			if !ok {
+				continue
+			}
+
+			if _, exists := originalName(current, to); exists {
+				return edits, fmt.Errorf("cannot rename %q to %q, both are set", from, to)
+			}
+
+			current[orig] = to
+		}
+
+		for _, a := range m.Removals {
+			orig, ok := originalName(current, a)
+			if ok {
+				removed[orig] = true
+				delete(current, orig)
+			}
+		}
+
+		if !isBase {
+			continue
+		}
+
+		for _, a := range sortedKeys(m.Defaults) {
+			if _, ok := originalName(current, a); ok {
+				continue
+			}
+
+			// pinned attributes are tracked by a key that
+			// cannot clash with names in the file
+			key := fmt.Sprintf("+%s", a)
+			pinned = append(pinned, key)
+			pinnedValues[key] = m.Defaults[a]
+			current[key] = a
+		}
+	}
+
+	for orig, item := range names {
+		kr := item.KeyExpr.Range()
+
+		if removed[orig] {
+			start, end := lineRange(src, kr.Start.Byte, item.ValueExpr.Range().End.Byte)
+			edits = append(edits, sourceEdit{start: start, end: end})
+			continue
+		}
+
+		if current[orig] != orig {
+			edits = append(edits, sourceEdit{
+				start: kr.Start.Byte,
+				end:   kr.End.Byte,
+				text:  current[orig],
+			})
+		}
+	}
+
+	lines := []string{}
+	for _, orig := range pinned {
+		if removed[orig] {
+			continue
+		}
+
+		tokens := hclwrite.TokensForValue(pinnedValues[orig])
+		lines = append(lines, fmt.Sprintf("%s = %s", current[orig], tokens.Bytes()))
+	}
+
+	if len(lines) > 0 {
+		// insert before the closing brace, at the start
+		// of its line if it is on a line of its own
+		pos := attrs.SrcRange.End.Byte - 1
+		for pos > 0 && (src[pos-1] == ' ' || src[pos-1] == '\t') {
+			pos--
+		}
+
+		text := fmt.Sprintf("%s\n", strings.Join(lines, "\n"))
+		if src[pos-1] != '\n' {
+			pos = attrs.SrcRange.End.Byte - 1
+			text = fmt.Sprintf("\n%s", text)
+		}
+
+		edits = append(edits, sourceEdit{start: pos, end: pos, text: text})
+	}
+
+	return edits, nil
+}
+
+// originalName returns the attribute name in the file
+// that is currently named name
+func originalName(current map[string]string, name string) (string, bool) {
+	for orig, n := range current {
+		if n == name {
+			return orig, true
+		}
+	}
+
+	return "", false
+}
+
+// lineRange extends start and end to the full line, if nothing
+// but whitespace and a trailing comma surround them, otherwise
+// only the trailing comma and whitespace are included
+func lineRange(src []byte, start, end int) (int, int) {
+	s := start
+	for s > 0 && (src[s-1] == ' ' || src[s-1] == '\t') {
+		s--
+	}
+
+	e := end
+	for e < len(src) && (src[e] == ' ' || src[e] == '\t' || src[e] == ',') {
+		e++
+	}
+
+	lineStart := s == 0 || src[s-1] == '\n'
+	lineEnd := e == len(src) || src[e] == '\n'
+	if lineStart && lineEnd {
+		if e < len(src) {
+			e++
+		}
+		return s, e
+	}
+
+	return start, e
+}
+
+func objectKey(expr hclsyntax.Expression) (string, error) {
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	if v.Type() != cty.String || !v.IsKnown() || v.IsNull() {
+		return "", fmt.Errorf("invalid object key")
+	}
+
+	return v.AsString(), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := maps.Keys(m)
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,207 @@
+package stack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/mod/semver"
+)
+
+func withTestMigrations(t *testing.T, ms []Migration) {
+	orig := migrations
+	migrations = ms
+	t.Cleanup(func() {
+		migrations = orig
+	})
+}
+
+func TestMigrationsFor(t *testing.T) {
+	withTestMigrations(t, []Migration{
+		{To: "v0.18.2-beta.0", Type: "cluster", Provider: "aws"},
+		{To: "v0.18.1-beta.0", Type: "cluster"},
+		{From: "v0.18.1-beta.0", To: "v0.18.2-beta.0", Type: "node-pool"},
+	})
+
+	ms := migrationsFor("cluster", "aws", "v0.18.0-beta.0", "v0.18.2-beta.0")
+	assert.Len(t, ms, 2, nil)
+	assert.Equal(t, "v0.18.1-beta.0", ms[0].To, nil)
+	assert.Equal(t, "v0.18.2-beta.0", ms[1].To, nil)
+
+	ms = migrationsFor("cluster", "google", "v0.18.1-beta.0", "v0.18.2-beta.0")
+	assert.Len(t, ms, 0, nil)
+
+	ms = migrationsFor("node_pool", "google", "v0.18.1-beta.0", "v0.18.2-beta.0")
+	assert.Len(t, ms, 1, nil)
+
+	// updates from below the range do not match
+	ms = migrationsFor("node_pool", "google", "v0.18.0-beta.0", "v0.18.2-beta.0")
+	assert.Len(t, ms, 0, nil)
+
+	// downgrades do not migrate
+	ms = migrationsFor("cluster", "aws", "v0.18.2-beta.0", "v0.18.0-beta.0")
+	assert.Len(t, ms, 0, nil)
+}
+
+func TestMigrationsRegistry(t *testing.T) {
+	for _, m := range migrations {
+		err := validateMigration(m)
+		assert.Equal(t, nil, err, m.To)
+
+		// an update across the range finds the entry
+		from := m.From
+		if from == "" {
+			from = "v0.0.0"
+		}
+		found := false
+		for _, fm := range migrationsFor(m.Type, m.Provider, util.CanonicalVersion(from), util.CanonicalVersion(m.To)) {
+			if fm.To == m.To && fm.From == m.From {
+				found = true
+			}
+		}
+		assert.True(t, found, m.To)
+	}
+}
+
+func TestMigrationValidate(t *testing.T) {
+	err := validateMigration(Migration{From: "v0.18.1-beta.0", To: "v0.18.2-beta.0", Type: "cluster"})
+	assert.Equal(t, nil, err, nil)
+
+	err = validateMigration(Migration{From: "v0.18.2-beta.0", To: "v0.18.1-beta.0", Type: "cluster"})
+	assert.EqualError(t, err, `from version "v0.18.2-beta.0" is not below to version "v0.18.1-beta.0"`, nil)
+
+	err = validateMigration(Migration{To: "latest", Type: "cluster"})
+	assert.EqualError(t, err, `invalid to version "latest"`, nil)
+
+	err = validateMigration(Migration{To: "v0.18.1-beta.0", Type: "service"})
+	assert.EqualError(t, err, `invalid type "service", choose one of ["cluster" "node-pool"]`, nil)
+}
+
+// validateMigration returns an error if the range or type of m is invalid
+func validateMigration(m Migration) error {
+	if !semver.IsValid(util.CanonicalVersion(m.To)) {
+		return fmt.Errorf("invalid to version %q", m.To)
+	}
+
+	if m.From != "" {
+		if !semver.IsValid(util.CanonicalVersion(m.From)) {
+			return fmt.Errorf("invalid from version %q", m.From)
+		}
+
+		if semver.Compare(util.CanonicalVersion(m.From), util.CanonicalVersion(m.To)) >= 0 {
+			return fmt.Errorf("from version %q is not below to version %q", m.From, m.To)
+		}
+	}
+
+	if m.Type != "cluster" && m.Type != "node-pool" {
+		return fmt.Errorf("invalid type %q, choose one of %q", m.Type, []string{"cluster", "node-pool"})
+	}
+
+	return nil
+}
+
+func TestMigrateConfigurations(t *testing.T) {
+	src := []byte(`module "eks_test" {
+  source = "github.com/kbst/terraform-kubestack//aws/cluster?ref=v0.18.1-beta.0"
+
+  configuration_base_key = "apps-prd"
+  configuration = {
+    apps-prd = {
+      base_domain           = var.base_domain
+      cluster_instance_type = "t3a.xlarge"
+      cluster_min_size      = 3
+      deprecated            = true
+    }
+    apps-stg = {
+      cluster_instance_type = "t3a.medium"
+    }
+    ops = {}
+  }
+}
+`)
+
+	ms := []Migration{
+		{
+			To:       "v0.18.2-beta.0",
+			Type:     "cluster",
+			Renames:  map[string]string{"cluster_instance_type": "instance_types"},
+			Removals: []string{"deprecated"},
+			Defaults: map[string]cty.Value{"enabled_cluster_log_types": cty.StringVal("api")},
+		},
+	}
+
+	out, err := migrateConfigurations(src, "test.tf", map[string][]Migration{"eks_test": ms}, map[string]string{"eks_test": "apps-prd"})
+	assert.Equal(t, nil, err, nil)
+
+	expected := `module "eks_test" {
+  source = "github.com/kbst/terraform-kubestack//aws/cluster?ref=v0.18.1-beta.0"
+
+  configuration_base_key = "apps-prd"
+  configuration = {
+    apps-prd = {
+      base_domain               = var.base_domain
+      instance_types            = "t3a.xlarge"
+      cluster_min_size          = 3
+      enabled_cluster_log_types = "api"
+    }
+    apps-stg = {
+      instance_types = "t3a.medium"
+    }
+    ops = {}
+  }
+}
+`
+	assert.Equal(t, expected, string(out), nil)
+}
+
+func TestMigrateConfigurationsRenameConflict(t *testing.T) {
+	src := []byte(`module "eks_test" {
+  configuration = {
+    apps = {
+      old = 1
+      new = 2
+    }
+  }
+}
+`)
+
+	ms := []Migration{{Renames: map[string]string{"old": "new"}}}
+
+	_, err := migrateConfigurations(src, "test.tf", map[string][]Migration{"eks_test": ms}, map[string]string{})
+	assert.ErrorContains(t, err, `cannot rename "old" to "new", both are set`, nil)
+}
+
+func TestUpdateMigrations(t *testing.T) {
+	withTestMigrations(t, []Migration{
+		{
+			To:       "v0.18.2-beta.0",
+			Type:     "node-pool",
+			Provider: "aws",
+			Renames:  map[string]string{"desired_capacity": "desired_size"},
+			Defaults: map[string]cty.Value{"disk_size": cty.NumberIntVal(20)},
+			Sources:  map[string]string{"aws/cluster/node-pool": "aws/node-pool"},
+		},
+	})
+
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	updates, _, err := s.Update(UpdateFilter{Module: "eks_gc0_eu-west-1_node_pool_extra"})
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, updates, 1, nil)
+	assert.Len(t, updates[0].Migrations, 1, nil)
+
+	data, err := os.ReadFile(filepath.Join(p, "eks_gc0_eu-west-1_node_pool_extra.tf"))
+	assert.Equal(t, nil, err, nil)
+
+	tf := string(data)
+	assert.Contains(t, tf, `source = "github.com/kbst/terraform-kubestack//aws/node-pool?ref=v0.18.2-beta.0"`, nil)
+	assert.Contains(t, tf, "desired_size", nil)
+	assert.NotContains(t, tf, "desired_capacity", nil)
+	assert.Contains(t, tf, "disk_size", nil)
+	assert.Contains(t, tf, "cluster_name = module.eks_gc0_eu-west-1.current_metadata[\"name\"]", nil)
+}
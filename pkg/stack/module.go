@@ -1,13 +1,49 @@
 package stack
 
 import (
+	"path/filepath"
+	"strings"
+
 	"github.com/kbst/kbst/pkg/tfhcl"
 )
 
 type Module struct {
-	mod *tfhcl.Module
+	mod   *tfhcl.Module
+	root  *tfhcl.Root
+	child *tfhcl.Root
 }
 
 func (c *Module) Name() string {
 	return c.mod.Name
 }
+
+// Source returns the source of the module, local
+// sources are resolved relative to the repository root
+func (c *Module) Source() string {
+	if c.child == nil {
+		return c.mod.Source
+	}
+
+	rel, err := filepath.Rel(c.root.Path, c.child.Path)
+	if err != nil {
+		return c.mod.Source
+	}
+
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+
+	return rel
+}
+
+// Inputs returns the names of the variables of modules
+// with a local source, sorted, other modules have none
+func (c *Module) Inputs() (inputs []string) {
+	vs, _ := c.root.Inputs(c.mod.Name)
+	for _, v := range vs {
+		inputs = append(inputs, v.Name)
+	}
+
+	return inputs
+}
@@ -38,8 +38,10 @@ func (np *NodePool) Validate(cj util.CliJSON) error {
 
 	switch np.Provider {
 	case "aws":
-		its := baseCfg["instance_types"].AsString()
-		instanceType = strings.Split(its, ",")[0]
+		its := instanceTypes(baseCfg["instance_types"])
+		if len(its) > 0 {
+			instanceType = its[0]
+		}
 
 		azs, found := baseCfg["availability_zones"]
 		if found {
@@ -86,6 +88,24 @@ func (np *NodePool) Validate(cj util.CliJSON) error {
 	return nil
 }
 
+func (np *NodePool) NodeShape(env string) (ns NodeShape, err error) {
+	attrs, err := effectiveAttributes(np.Configurations, env)
+	if err != nil {
+		return ns, err
+	}
+
+	switch np.Provider {
+	case "aws":
+		ns = nodeShape(attrs, "instance_types", "min_size", "max_size")
+	case "azurerm":
+		ns = nodeShape(attrs, "vm_size", "min_count", "max_count")
+	case "google":
+		ns = nodeShape(attrs, "machine_type", "min_node_count", "max_node_count")
+	}
+
+	return ns, nil
+}
+
 func (np *NodePool) ToHCL() map[string][]byte {
 	files := make(map[string][]byte)
 	f := hclwrite.NewEmptyFile()
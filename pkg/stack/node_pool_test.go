@@ -2,6 +2,7 @@ package stack
 
 import (
 	"log"
+	"os"
 	"testing"
 
 	"github.com/kbst/kbst/pkg/util"
@@ -75,6 +76,33 @@ func TestNodePoolRejectEmptyConfiguration(t *testing.T) {
 	assert.EqualError(t, err, "invalid empty configuration []", nil)
 }
 
+func TestNodePoolInstanceTypesList(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-eks-node-pool-list")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	nps := s.NodePools()
+	assert.Len(t, nps, 1, nil)
+
+	// a tuple
+	ns, err := nps[0].NodeShape("apps-prod")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, NodeShape{InstanceType: "t3a.xlarge,t3a.large", MinNodes: 3, MaxNodes: 9}, ns, nil)
+
+	// a list
+	ns, err = nps[0].NodeShape("apps")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, NodeShape{InstanceType: "t3a.medium", MinNodes: 3, MaxNodes: 9}, ns, nil)
+
+	// the first instance type is validated
+	cj := util.CliJSON{}
+	err = cj.Load(util.CachedDownloader{})
+	assert.Equal(t, nil, err, nil)
+
+	err = nps[0].Validate(cj)
+	assert.Equal(t, nil, err, nil)
+}
+
 func TestNodePoolToHCL(t *testing.T) {
 	np := NodePool{
 		PoolName:       "test-extra",
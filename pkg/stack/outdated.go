@@ -0,0 +1,93 @@
+package stack
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kbst/kbst/pkg/util"
+	"golang.org/x/mod/semver"
+)
+
+// ModuleStatus is the current and latest
+// available version of a module
+type ModuleStatus struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Cluster string `json:"cluster"`
+	Current string `json:"current"`
+	Latest  string `json:"latest"`
+
+	// Behind is major, minor, patch or prerelease,
+	// depending on the most significant difference
+	// between Current and Latest, empty if up to date
+	Behind string `json:"behind"`
+}
+
+func (ms ModuleStatus) Outdated() bool {
+	return ms.Behind != ""
+}
+
+// Outdated returns the version status of all cluster, node pool,
+// service and elb-dns modules matching f, f.To is ignored
+func (s *Stack) Outdated(f UpdateFilter) (statuses []ModuleStatus, err error) {
+	for _, mods := range s.root.Modules {
+		for _, m := range mods {
+			t, cluster, entryName, current, ok := moduleVersionInfo(m)
+			if !ok {
+				continue
+			}
+
+			if !f.matches(m.Name, t, cluster, entryName) {
+				continue
+			}
+
+			ms := ModuleStatus{
+				Name:    m.Name,
+				Type:    strings.ReplaceAll(t, "_", "-"),
+				Cluster: cluster,
+				Current: current,
+			}
+
+			entry, found := s.versionEntry(t, entryName)
+			if found && len(entry.Versions) > 0 {
+				latest, err := entry.GetReleaseOrLatest("latest")
+				if err != nil {
+					return statuses, err
+				}
+
+				ms.Latest = latest.Name
+				ms.Behind = versionDistance(current, latest.Name)
+			}
+
+			statuses = append(statuses, ms)
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses, nil
+}
+
+// versionDistance returns the most significant part that
+// differs between current and the newer latest version
+func versionDistance(current, latest string) string {
+	if semver.Compare(current, latest) >= 0 {
+		return ""
+	}
+
+	if semver.Major(current) != semver.Major(latest) {
+		return "major"
+	}
+
+	if semver.MajorMinor(current) != semver.MajorMinor(latest) {
+		return "minor"
+	}
+
+	if util.VersionCore(current) != util.VersionCore(latest) {
+		return "patch"
+	}
+
+	return "prerelease"
+}
@@ -0,0 +1,66 @@
+package stack
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutdated(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	statuses, err := s.Outdated(UpdateFilter{Cluster: "eks_gc0_eu-west-1"})
+	assert.Equal(t, nil, err, nil)
+
+	assert.Equal(t, []ModuleStatus{
+		{Name: "eks_gc0_eu-west-1", Type: "cluster", Cluster: "eks_gc0_eu-west-1", Current: "v0.18.1-beta.0", Latest: "v0.18.2-beta.0", Behind: "patch"},
+		{Name: "eks_gc0_eu-west-1_node_pool_extra", Type: "node-pool", Cluster: "eks_gc0_eu-west-1", Current: "v0.18.1-beta.0", Latest: "v0.18.2-beta.0", Behind: "patch"},
+		{Name: "eks_gc0_eu-west-1_service_nginx", Type: "service", Cluster: "eks_gc0_eu-west-1", Current: "v1.3.1-kbst.1", Latest: "v1.3.2-kbst.0", Behind: "patch"},
+		{Name: "eks_gc0_eu-west-1_service_prometheus", Type: "service", Cluster: "eks_gc0_eu-west-1", Current: "v0.61.0-kbst.0", Latest: "v0.60.1-kbst.1", Behind: ""},
+		{Name: "eks_gc0_eu-west-1_service_tektoncd", Type: "service", Cluster: "eks_gc0_eu-west-1", Current: "v0.42.0-kbst.0", Latest: "", Behind: ""},
+	}, statuses, nil)
+
+	// outdated does not change anything
+	statuses, err = s.Outdated(UpdateFilter{})
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, statuses, 15, nil)
+}
+
+func TestOutdatedELBDNS(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-eks-3envs")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	s.cliJSON = testUpdateCliJSON
+
+	statuses, err := s.Outdated(UpdateFilter{Type: "cluster"})
+	assert.Equal(t, nil, err, nil)
+
+	var found bool
+	for _, ms := range statuses {
+		if ms.Type == "elb-dns" {
+			found = true
+			assert.True(t, ms.Outdated(), nil)
+		}
+	}
+	assert.True(t, found, nil)
+}
+
+func TestVersionDistance(t *testing.T) {
+	cases := map[string][]string{
+		"":           {"v1.2.3", "v1.2.3"},
+		"major":      {"v0.18.1-beta.0", "v1.0.0"},
+		"minor":      {"v0.17.1-beta.0", "v0.18.0-beta.0"},
+		"patch":      {"v0.18.0-beta.0", "v0.18.1-beta.0"},
+		"prerelease": {"v1.3.1-kbst.0", "v1.3.1-kbst.1"},
+	}
+
+	for exp, c := range cases {
+		assert.Equal(t, exp, versionDistance(c[0], c[1]), c)
+	}
+
+	// newer than latest is not behind
+	assert.Equal(t, "", versionDistance("v0.61.0-kbst.0", "v0.60.1-kbst.1"), nil)
+}
@@ -0,0 +1,269 @@
+package stack
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ReplaceCluster replaces the version and configurations of the
+// existing cluster, the module keeps its name and file, node pools
+// and elb-dns modules of the cluster are bumped to its version
+func (s *Stack) ReplaceCluster(namePrefix, provider, region, version string, configurations []Configuration) (c Cluster, err error) {
+	if version == "" {
+		version = "latest"
+	}
+
+	frameworkVersion, err := s.cliJSON.Framework.GetReleaseOrLatest(version)
+	if err != nil {
+		return c, err
+	}
+
+	c.NamePrefix = namePrefix
+	c.Provider = provider
+	c.Region = region
+	c.Version = frameworkVersion.Name
+	c.Configurations = configurations
+
+	name := ""
+	clusters := []Cluster{}
+	for _, ec := range s.Clusters() {
+		if ec.NamePrefix == c.NamePrefix &&
+			ec.Provider == c.Provider &&
+			ec.Region == c.Region {
+			name = ec.Name()
+			clusters = append(clusters, c)
+			continue
+		}
+		clusters = append(clusters, ec)
+	}
+
+	if name == "" {
+		return c, fmt.Errorf("no cluster named %q found", c.Name())
+	}
+
+	err = c.Validate(s.cliJSON)
+	if err != nil {
+		return c, err
+	}
+
+	err = s.replaceModule(name, c.ToHCL()[fmt.Sprintf("%s_cluster.tf", c.Name())])
+	if err != nil {
+		return c, err
+	}
+
+	// node pools use the version of their cluster
+	for _, np := range s.NodePools() {
+		if np.ClusterName != name || np.Version == c.Version {
+			continue
+		}
+
+		np.mod = nil
+		np.Version = c.Version
+		err = s.replaceModule(np.Name(), np.ToHCL()[fmt.Sprintf("%s.tf", np.Name())])
+		if err != nil {
+			return c, err
+		}
+	}
+
+	// elb-dns modules are updated with their cluster, like Update does
+	for _, fn := range sortedKeys(s.root.Modules) {
+		for _, m := range s.root.Modules[fn] {
+			t, cluster, _, version, ok := moduleVersionInfo(m)
+			if !ok || t != "elb-dns" || cluster != name || version == c.Version {
+				continue
+			}
+
+			m := m
+			err = s.editModule(m.Name, func(b *hclwrite.Block) {
+				setModuleVersion(b, m, c.Version)
+			})
+			if err != nil {
+				return c, err
+			}
+		}
+	}
+
+	err = s.dockerfile(clusters)
+	if err != nil {
+		return c, err
+	}
+
+	err = s.root.Write()
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// ReplaceNodePool replaces the configurations of the existing
+// node pool and sets it to the version of its cluster, the
+// module keeps its name and file
+func (s *Stack) ReplaceNodePool(clusterName, poolName string, configurations []Configuration) (np NodePool, err error) {
+	version := ""
+	for _, c := range s.Clusters() {
+		if c.Name() == clusterName {
+			version = c.Version
+		}
+	}
+
+	name := ""
+	for _, enp := range s.NodePools() {
+		if enp.ClusterName == clusterName &&
+			enp.PoolName == poolName {
+			np = enp
+			name = enp.Name()
+		}
+	}
+
+	if name == "" {
+		return np, fmt.Errorf("no node pool %q found for cluster %q", poolName, clusterName)
+	}
+
+	np.mod = nil
+	np.Configurations = configurations
+	if version != "" {
+		np.Version = version
+	}
+
+	err = np.Validate(s.cliJSON)
+	if err != nil {
+		return np, err
+	}
+
+	err = s.replaceModule(name, np.ToHCL()[fmt.Sprintf("%s.tf", np.Name())])
+	if err != nil {
+		return np, err
+	}
+
+	err = s.root.Write()
+	if err != nil {
+		return np, err
+	}
+
+	return np, nil
+}
+
+// ReplaceService replaces the version and configurations of the
+// existing service, the module keeps its name and file, if
+// configurations is nil, empty configurations are generated
+func (s *Stack) ReplaceService(clusterName, entryName, version string, configurations []Configuration) (svc Service, err error) {
+	name := ""
+	for _, esvc := range s.Services() {
+		if esvc.ClusterName == clusterName &&
+			esvc.EntryName == entryName {
+			svc = esvc
+			name = esvc.Name()
+		}
+	}
+
+	if name == "" {
+		return svc, fmt.Errorf("no service %q found for cluster %q", entryName, clusterName)
+	}
+
+	catalogEntry, found := s.cliJSON.Catalog[entryName]
+	if !found {
+		return svc, fmt.Errorf("no entry named %q found in catalog", entryName)
+	}
+
+	if version == "" {
+		version = "latest"
+	}
+
+	catalogVersion, err := catalogEntry.GetReleaseOrLatest(version)
+	if err != nil {
+		return svc, err
+	}
+
+	svc.mod = nil
+	svc.Version = catalogVersion.Name
+	svc.Configurations = configurations
+	if svc.Configurations == nil {
+		svc.Configurations = GenerateConfigurations(s.Environments, map[string]cty.Value{})
+	}
+
+	err = s.replaceModule(name, svc.ToHCL()[fmt.Sprintf("%s.tf", svc.Name())])
+	if err != nil {
+		return svc, err
+	}
+
+	err = s.root.Write()
+	if err != nil {
+		return svc, err
+	}
+
+	return svc, nil
+}
+
+// replaceModule replaces the content of the block of module name
+// with the module block in data, in place, in the file the module
+// is defined in, so the order of blocks in the file is kept
+func (s *Stack) replaceModule(name string, data []byte) error {
+	nf, diags := hclwrite.ParseConfig(data, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	var nb *hclwrite.Block
+	for _, b := range nf.Body().Blocks() {
+		if b.Type() == "module" {
+			nb = b
+			break
+		}
+	}
+
+	if nb == nil {
+		return fmt.Errorf("no module block generated for %q", name)
+	}
+
+	return s.editModule(name, func(b *hclwrite.Block) {
+		b.Body().Clear()
+		b.Body().AppendUnstructuredTokens(nb.Body().BuildTokens(nil))
+	})
+}
+
+// editModule calls edit with the block of module name, in the
+// file the module is defined in, other blocks are kept as is
+func (s *Stack) editModule(name string, edit func(b *hclwrite.Block)) error {
+	files := s.root.Parser.Files()
+	for fn := range s.root.Modules {
+		if _, ok := s.moduleInFile(fn, name); !ok {
+			continue
+		}
+
+		if tfhcl.IsJSONFile(fn) {
+			return jsonModuleError(s.root.Path, fn, name)
+		}
+
+		// earlier edits may have changed the file
+		src := files[fn].Bytes
+		if data, ok := s.root.PendingFile(fn); ok {
+			src = data
+		}
+
+		wf, diags := hclwrite.ParseConfig(src, fn, hcl.InitialPos)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		b := wf.Body().FirstMatchingBlock("module", []string{name})
+		if b == nil {
+			return fmt.Errorf("no module named %q found", name)
+		}
+		edit(b)
+
+		rel, err := filepath.Rel(s.root.Path, fn)
+		if err != nil {
+			return err
+		}
+
+		return s.root.WriteFiles(map[string][]byte{rel: hclwrite.Format(wf.Bytes())})
+	}
+
+	return fmt.Errorf("no module named %q found", name)
+}
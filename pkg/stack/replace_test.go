@@ -0,0 +1,87 @@
+package stack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceClusterBumpsNodePools(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	// validating the cluster needs the regions
+	cj := util.CliJSON{}
+	err := cj.Load(util.CachedDownloader{})
+	assert.Equal(t, nil, err, nil)
+	s.cliJSON.CloudInfo = cj.CloudInfo
+
+	c := s.Clusters()[0]
+	before := map[string]string{}
+	for _, np := range s.NodePools() {
+		before[np.Name()] = np.Version
+	}
+
+	_, err = s.ReplaceCluster(c.NamePrefix, c.Provider, c.Region, "v0.18.2-beta.0", c.Configurations)
+	assert.Equal(t, nil, err, nil)
+
+	var bumped int
+	for _, np := range s.NodePools() {
+		if np.ClusterName != c.Name() {
+			assert.Equal(t, before[np.Name()], np.Version, np.Name())
+			continue
+		}
+
+		assert.Equal(t, "v0.18.2-beta.0", np.Version, np.Name())
+		bumped++
+	}
+	assert.Equal(t, 1, bumped, nil)
+}
+
+func TestReplaceClusterBumpsELBDNS(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-eks-3envs")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	// validating the cluster needs the regions
+	cj := util.CliJSON{}
+	err = cj.Load(util.CachedDownloader{})
+	assert.Equal(t, nil, err, nil)
+	s.cliJSON = testUpdateCliJSON
+	s.cliJSON.CloudInfo = cj.CloudInfo
+
+	c := s.Clusters()[0]
+	_, err = s.ReplaceCluster(c.NamePrefix, c.Provider, c.Region, "v0.18.2-beta.0", c.Configurations)
+	assert.Equal(t, nil, err, nil)
+
+	data, err := os.ReadFile(filepath.Join(p, "eks_gc0_eu-west-1_ingress.tf"))
+	assert.Equal(t, nil, err, nil)
+	assert.Contains(t, string(data), `source = "github.com/kbst/terraform-kubestack//aws/cluster/elb-dns?ref=v0.18.2-beta.0"`, nil)
+}
+
+func TestReplaceServiceInPlace(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-eks-3envs")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+	s.cliJSON = testUpdateCliJSON
+
+	fn := filepath.Join(p, "eks_gc0_eu-west-1_ingress.tf")
+	before, err := os.ReadFile(fn)
+	assert.Equal(t, nil, err, nil)
+	dnsZone := string(before[strings.Index(string(before), `module "eks_gc0_eu-west-1_dns_zone"`):])
+
+	_, err = s.ReplaceService("eks_gc0_eu-west-1", "nginx", "1.3.2-kbst.0", nil)
+	assert.Equal(t, nil, err, nil)
+
+	after, err := os.ReadFile(fn)
+	assert.Equal(t, nil, err, nil)
+
+	// the replaced module stays first, the other one is unchanged
+	assert.True(t, strings.HasPrefix(string(after), `module "eks_gc0_eu-west-1_nginx" {`), string(after))
+	assert.Contains(t, string(after), `version = "1.3.2-kbst.0"`, nil)
+	assert.True(t, strings.HasSuffix(string(after), "\n\n"+dnsZone), string(after))
+}
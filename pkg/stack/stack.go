@@ -49,6 +49,20 @@ func (s *Stack) FromPath() error {
 		return err
 	}
 
+	// read the directories of the project config too
+	pc, err := s.ProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	if !slices.Equal(s.root.Dirs, pc.Directories) {
+		s.root.Dirs = pc.Directories
+		err = s.root.Read()
+		if err != nil {
+			return err
+		}
+	}
+
 	// read base_domain
 	bd, ok := s.root.GetVariableValue("base_domain")
 	if !ok {
@@ -56,6 +70,17 @@ func (s *Stack) FromPath() error {
 	}
 	s.SetBaseDomain(bd)
 
+	// restrict versions to the project's channel,
+	// unless a channel was chosen explicitly
+	if s.cliJSON.Channel == "" {
+		if pc.Channel != "" {
+			err = s.cliJSON.SetChannel(pc.Channel)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	// read environments
 	for _, mods := range s.root.Modules {
 		for _, m := range mods {
@@ -102,6 +127,10 @@ func (s *Stack) SetBaseDomain(bd cty.Value) {
 	s.root.SetVariableValue("base_domain", bd)
 }
 
+func (s *Stack) BaseDomain() string {
+	return s.baseDomain
+}
+
 func (s *Stack) Clusters() (clusters []Cluster) {
 	for _, mods := range s.root.Modules {
 		for i := range mods {
@@ -295,7 +324,9 @@ func (s *Stack) Modules() (modules []Module) {
 			}
 
 			modules = append(modules, Module{
-				mod: &m,
+				mod:   &m,
+				root:  s.root,
+				child: s.root.Children[m.Name],
 			})
 		}
 	}
@@ -307,26 +338,24 @@ func (s *Stack) Modules() (modules []Module) {
 	return modules
 }
 
-func (s *Stack) dockerfile() (out []byte, err error) {
+// dockerfile queues changes to the Dockerfile required
+// by clusters, it does not write them
+func (s *Stack) dockerfile(clusters []Cluster) error {
 	for k, v := range s.root.Parser.Files() {
 		if !strings.HasSuffix(k, "Dockerfile") {
 			continue
 		}
-		out = v.Bytes
 
-		nd := dockerfile(out, s.Clusters())
-		if !bytes.Equal(out, nd) {
-			s.root.WriteFiles(map[string][]byte{"Dockerfile": nd})
-			out = nd
+		nd := dockerfile(v.Bytes, clusters)
+		if !bytes.Equal(v.Bytes, nd) {
+			err := s.root.WriteFiles(map[string][]byte{"Dockerfile": nd})
+			if err != nil {
+				return err
+			}
 		}
 	}
 
-	err = s.root.Write()
-	if err != nil {
-		return out, err
-	}
-
-	return out, nil
+	return nil
 }
 
 func (s *Stack) InitFiles(baseDomain string) error {
@@ -389,12 +418,12 @@ func (s *Stack) AddCluster(namePrefix, provider, region, version string, configu
 		return c, err
 	}
 
-	err = s.root.Write()
+	err = s.dockerfile(append(s.Clusters(), c))
 	if err != nil {
 		return c, err
 	}
 
-	_, err = s.dockerfile()
+	err = s.root.Write()
 	if err != nil {
 		return c, err
 	}
@@ -448,7 +477,9 @@ func (s *Stack) AddNodePool(clusterName, poolName string, configurations []Confi
 	return np, nil
 }
 
-func (s *Stack) AddService(clusterName, entryName, version string) (svc Service, err error) {
+// AddService adds the catalog entry as a service to the cluster,
+// if configurations is nil, empty configurations are generated
+func (s *Stack) AddService(clusterName, entryName, version string, configurations []Configuration) (svc Service, err error) {
 	var foundCluster bool
 	for _, c := range s.Clusters() {
 		if c.Name() == clusterName {
@@ -478,7 +509,10 @@ func (s *Stack) AddService(clusterName, entryName, version string) (svc Service,
 	svc.EntryName = entryName
 	svc.Provider = "kustomization"
 	svc.Version = catalogVersion.Name
-	svc.Configurations = GenerateConfigurations(s.Environments, map[string]cty.Value{})
+	svc.Configurations = configurations
+	if svc.Configurations == nil {
+		svc.Configurations = GenerateConfigurations(s.Environments, map[string]cty.Value{})
+	}
 
 	for _, esvc := range s.Services() {
 		if esvc.ClusterName == svc.ClusterName &&
@@ -509,7 +543,7 @@ func (s *Stack) Remove(rm string) error {
 				return err
 			}
 
-			if kind == "cluster" && len(s.Clusters()) == 1 {
+			if kind == "cluster" && m.Name == rm && len(s.Clusters()) == 1 {
 				return fmt.Errorf("stacks require one cluster, not removing %q", m.Name)
 			}
 
@@ -537,18 +571,34 @@ func (s *Stack) Remove(rm string) error {
 			return err
 		}
 
-		err = s.root.Write()
-		if err != nil {
-			return err
+		remaining := []Cluster{}
+		for _, c := range s.Clusters() {
+			if c.Name() != rm {
+				remaining = append(remaining, c)
+			}
 		}
 
-		_, err = s.dockerfile()
+		err = s.dockerfile(remaining)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return s.root.Write()
 	}
 
 	return fmt.Errorf("error %q did not match any clusters, node pools or services", rm)
 }
+
+// Batch calls f and writes all changes f makes to the
+// repository at once, if f fails, nothing is written
+func (s *Stack) Batch(f func() error) error {
+	s.root.Begin()
+
+	err := f()
+	if err != nil {
+		s.root.Rollback()
+		return err
+	}
+
+	return s.root.Commit()
+}
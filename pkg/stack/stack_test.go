@@ -106,7 +106,7 @@ func TestWriteChanges(t *testing.T) {
 	_, err = s.AddNodePool(clusterName, poolName, GenerateConfigurations(s.Environments, npBaseCfg))
 	assert.Equal(t, err, nil, nil)
 
-	_, err = s.AddService(clusterName, "prometheus", "")
+	_, err = s.AddService(clusterName, "prometheus", "", nil)
 	assert.Equal(t, err, nil, nil)
 
 	diffs, err := getGitDiffs(p)
@@ -244,7 +244,7 @@ func TestAddService(t *testing.T) {
 	assert.Equal(t, nil, err, nil)
 
 	for _, ex := range s.Clusters() {
-		_, err = s.AddService(ex.Name(), "sealed-secrets", "")
+		_, err = s.AddService(ex.Name(), "sealed-secrets", "", nil)
 		assert.Equal(t, err, nil, nil)
 	}
 
@@ -255,7 +255,7 @@ func TestAddServiceRejectNoCluster(t *testing.T) {
 	s, p, err := newTestRepoFromFixture("kubestack-starter-multi-4envs")
 	assert.Equal(t, nil, err, nil)
 
-	_, err = s.AddService("no_such_cluster", "", "")
+	_, err = s.AddService("no_such_cluster", "", "", nil)
 	assert.EqualError(t, err, "no cluster named \"no_such_cluster\" found", nil)
 
 	os.RemoveAll(p)
@@ -266,13 +266,70 @@ func TestAddServiceRejectDuplicate(t *testing.T) {
 	assert.Equal(t, nil, err, nil)
 
 	for _, ex := range s.Services() {
-		_, err = s.AddService(ex.ClusterName, ex.EntryName, "")
+		_, err = s.AddService(ex.ClusterName, ex.EntryName, "", nil)
 		assert.EqualError(t, err, fmt.Sprintf("error: service %q already exists", ex.Name()), nil)
 	}
 
 	os.RemoveAll(p)
 }
 
+func TestAddServiceDryRun(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-multi-4envs")
+	assert.Equal(t, nil, err, nil)
+
+	s.root.DryRun = true
+
+	expLen := len(s.Services()) + len(s.Clusters())
+	for _, ex := range s.Clusters() {
+		_, err = s.AddService(ex.Name(), "sealed-secrets", "", nil)
+		assert.Equal(t, err, nil, nil)
+	}
+
+	// later changes see earlier ones
+	assert.Equal(t, expLen, len(s.Services()), nil)
+
+	changes, err := s.root.Changes()
+	assert.Equal(t, nil, err, nil)
+	assert.NotEmpty(t, changes, nil)
+
+	// nothing was written to disk
+	out, err := exec.Command("/bin/bash", "-c", fmt.Sprintf("cd %s && git status --porcelain", p)).CombinedOutput()
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, "", string(out), nil)
+
+	os.RemoveAll(p)
+}
+
+func TestRemoveClusterDryRun(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-multi-4envs")
+	assert.Equal(t, nil, err, nil)
+
+	s.root.DryRun = true
+
+	clusters := s.Clusters()
+	err = s.Remove(clusters[0].Name())
+	assert.Equal(t, nil, err, nil)
+
+	assert.Equal(t, len(clusters)-1, len(s.Clusters()), nil)
+
+	changes, err := s.root.Changes()
+	assert.Equal(t, nil, err, nil)
+
+	var deleted int
+	for _, c := range changes {
+		if c.Deleted() {
+			deleted++
+		}
+	}
+	assert.NotEqual(t, 0, deleted, nil)
+
+	// nothing was deleted from disk
+	out, _ := exec.Command("/bin/bash", "-c", fmt.Sprintf("cd %s && git status --porcelain", p)).CombinedOutput()
+	assert.Equal(t, "", string(out), nil)
+
+	os.RemoveAll(p)
+}
+
 func TestRemoveCluster(t *testing.T) {
 	s, p, err := newTestRepoFromFixture("kubestack-starter-multi-4envs")
 	assert.Equal(t, nil, err, nil)
@@ -309,6 +366,23 @@ func TestRemoveClusterRejectLast(t *testing.T) {
 	os.RemoveAll(p)
 }
 
+func TestRemoveServiceLastCluster(t *testing.T) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-eks-3envs")
+	assert.Equal(t, nil, err, nil)
+
+	assert.Len(t, s.Clusters(), 1, nil)
+
+	services := s.Services()
+	assert.NotEmpty(t, services, nil)
+
+	err = s.Remove(services[0].Name())
+	assert.Equal(t, nil, err, nil)
+
+	assert.Equal(t, len(services)-1, len(s.Services()), nil)
+
+	os.RemoveAll(p)
+}
+
 func TestRemoveNodePool(t *testing.T) {
 	s, p, err := newTestRepoFromFixture("kubestack-starter-multi-4envs")
 	assert.Equal(t, nil, err, nil)
@@ -0,0 +1,4 @@
+variable "base_domain" {
+  type        = string
+  description = "Used to generate fully qualified domain names for all clusters."
+}
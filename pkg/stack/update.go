@@ -0,0 +1,462 @@
+package stack
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"golang.org/x/mod/semver"
+)
+
+var updateTypes = []string{"cluster", "node-pool", "service"}
+
+// UpdateFilter selects the modules Update changes,
+// empty fields match all modules
+type UpdateFilter struct {
+	// Cluster is the name of the cluster modules belong to
+	Cluster string
+
+	// Type is one of cluster, node-pool or service,
+	// elb-dns modules are updated with clusters
+	Type string
+
+	// Service is the catalog entry name of services
+	Service string
+
+	// Module is the name of a single module
+	Module string
+
+	// To is the version to update to, defaults to latest, an
+	// explicit version only updates modules whose entry has it
+	To string
+
+	// Policy restricts the upgrade path of framework modules
+	Policy UpgradePolicy
+
+	// skipWithoutTo skips modules whose entry has
+	// no version matching To, instead of failing
+	skipWithoutTo bool
+}
+
+type ModuleUpdate struct {
+	Name string
+	Type string
+	From string
+	To   string
+
+	// Path are the framework versions to upgrade through
+	// to reach the target, starting with To
+	Path []string
+
+	// Migrations are the framework migrations
+	// applied to the module's configuration
+	Migrations []Migration
+}
+
+func (mu ModuleUpdate) String() string {
+	return fmt.Sprintf("%s: %s -> %s", mu.Name, mu.From, mu.To)
+}
+
+// Update bumps the versions of all modules matching f, applies
+// framework migrations and writes all changes at once, warnings
+// describe problems of the result that do not fail the update
+func (s *Stack) Update(f UpdateFilter) (updates []ModuleUpdate, warnings []string, err error) {
+	if f.Type != "" && !slices.Contains(updateTypes, f.Type) {
+		return updates, warnings, fmt.Errorf("invalid type %q, choose one of %q", f.Type, updateTypes)
+	}
+
+	if f.Module != "" && !s.hasModule(f.Module) {
+		return updates, warnings, fmt.Errorf("no module named %q found", f.Module)
+	}
+
+	// an explicit version applies to the modules whose entry
+	// has it, e.g. only to framework modules of stacks that
+	// also have services, if no entry has it, the update fails
+	if f.explicitTo() {
+		f.skipWithoutTo = s.hasVersionTo(f)
+	}
+
+	files := s.root.Parser.Files()
+	names := maps.Keys(files)
+	sort.Strings(names)
+
+	toWrite := map[string][]byte{}
+	for _, n := range names {
+		if tfhcl.IsJSONFile(n) {
+			err = s.jsonModuleUpdates(n, f)
+			if err != nil {
+				return updates, warnings, err
+			}
+			continue
+		}
+
+		if !strings.HasSuffix(n, ".tf") {
+			continue
+		}
+
+		wf, diag := hclwrite.ParseConfig(files[n].Bytes, n, hcl.InitialPos)
+		if diag.HasErrors() {
+			continue
+		}
+
+		var changed bool
+		toMigrate := map[string][]Migration{}
+		baseKeys := map[string]string{}
+		for _, b := range wf.Body().Blocks() {
+			if b.Type() != "module" || len(b.Labels()) != 1 {
+				continue
+			}
+
+			m, ok := s.moduleInFile(n, b.Labels()[0])
+			if !ok {
+				continue
+			}
+
+			u, ok, err := s.moduleUpdate(m, f)
+			if err != nil {
+				return updates, warnings, err
+			}
+			if !ok {
+				continue
+			}
+
+			setModuleVersion(b, m, u.To)
+
+			_, p, _, _ := m.TypeProviderVersion()
+			u.Migrations = migrationsFor(u.Type, p, u.From, u.To)
+			if len(u.Migrations) > 0 {
+				setModuleSource(b, u.Migrations)
+				toMigrate[m.Name] = u.Migrations
+				baseKeys[m.Name] = m.ConfigurationBaseKey
+			}
+
+			updates = append(updates, u)
+			changed = true
+		}
+
+		if !changed {
+			continue
+		}
+
+		data, err := migrateConfigurations(wf.Bytes(), n, toMigrate, baseKeys)
+		if err != nil {
+			return updates, warnings, err
+		}
+
+		rel, err := filepath.Rel(s.root.Path, n)
+		if err != nil {
+			return updates, warnings, err
+		}
+		toWrite[rel] = data
+	}
+
+	dfs, warnings, err := s.dockerfileUpdates(updates)
+	if err != nil {
+		return updates, warnings, err
+	}
+	maps.Copy(toWrite, dfs)
+
+	if len(toWrite) == 0 {
+		return updates, warnings, nil
+	}
+
+	err = s.root.WriteFiles(toWrite)
+	if err != nil {
+		return updates, warnings, err
+	}
+
+	err = s.root.Write()
+	if err != nil {
+		return updates, warnings, err
+	}
+
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].Name < updates[j].Name
+	})
+
+	return updates, warnings, nil
+}
+
+// dockerfileUpdates returns the Dockerfiles with the framework
+// image set to the newest framework version clusters use after
+// updates, and a warning if clusters use different versions
+func (s *Stack) dockerfileUpdates(updates []ModuleUpdate) (toWrite map[string][]byte, warnings []string, err error) {
+	toWrite = map[string][]byte{}
+
+	versions := []string{}
+	for _, c := range s.Clusters() {
+		v := c.Version
+		for _, u := range updates {
+			if u.Name == c.Name() {
+				v = u.To
+			}
+		}
+
+		if !slices.Contains(versions, v) {
+			versions = append(versions, v)
+		}
+	}
+
+	if len(versions) == 0 {
+		return toWrite, warnings, nil
+	}
+
+	semver.Sort(versions)
+	version := versions[len(versions)-1]
+
+	if len(versions) > 1 {
+		warnings = append(warnings, fmt.Sprintf("clusters use mixed framework versions %q, using %q for the Dockerfile", versions, version))
+	}
+
+	for n, f := range s.root.Parser.Files() {
+		base := filepath.Base(n)
+		if base != "Dockerfile" && base != "Dockerfile.loc" {
+			continue
+		}
+
+		nd := dockerfileVersion(f.Bytes, version)
+		if bytes.Equal(f.Bytes, nd) {
+			continue
+		}
+
+		rel, err := filepath.Rel(s.root.Path, n)
+		if err != nil {
+			return toWrite, warnings, err
+		}
+		toWrite[rel] = nd
+	}
+
+	return toWrite, warnings, nil
+}
+
+// moduleUpdate returns the update for m, ok is false
+// if m does not match f or is already at the target version
+func (s *Stack) moduleUpdate(m tfhcl.Module, f UpdateFilter) (u ModuleUpdate, ok bool, err error) {
+	t, cluster, entryName, current, ok := moduleVersionInfo(m)
+	if !ok {
+		return u, false, nil
+	}
+
+	if !f.matches(m.Name, t, cluster, entryName) {
+		return u, false, nil
+	}
+
+	entry, found := s.versionEntry(t, entryName)
+	if !found {
+		return u, false, nil
+	}
+
+	explicit := f.explicitTo()
+
+	// the chosen channel may have no versions at all
+	if len(entry.Versions) == 0 && !explicit {
+		return u, false, nil
+	}
+
+	to := "latest"
+	if explicit {
+		to = f.To
+	}
+
+	target, err := entry.GetReleaseOrLatest(to)
+	if err != nil {
+		if f.skipWithoutTo {
+			return u, false, nil
+		}
+
+		return u, false, fmt.Errorf("%s: %s", m.Name, err)
+	}
+
+	c := semver.Compare(current, target.Name)
+	if c == 0 {
+		return u, false, nil
+	}
+
+	// never downgrade, unless asked to explicitly
+	if c > 0 && !explicit {
+		return u, false, nil
+	}
+
+	u = ModuleUpdate{
+		Name: m.Name,
+		Type: t,
+		From: current,
+		To:   target.Name,
+	}
+
+	// framework upgrades follow the upgrade path one step at a time
+	if t != "service" && c < 0 {
+		u.Path = upgradePath(entry.Versions, current, target.Name, explicit, f.Policy)
+		if len(u.Path) == 0 {
+			return u, false, nil
+		}
+
+		u.To = u.Path[0]
+	}
+
+	return u, true, nil
+}
+
+// moduleVersionInfo returns the type, cluster name, catalog entry
+// name and version of framework and service modules, ok is false
+// for other modules
+func moduleVersionInfo(m tfhcl.Module) (t, cluster, entryName, version string, ok bool) {
+	t, _, version, err := m.TypeProviderVersion()
+	if err != nil {
+		return t, cluster, entryName, version, false
+	}
+
+	cluster = m.Name
+	if t != "cluster" {
+		cluster, err = m.ParentCluster()
+		if err != nil {
+			return t, cluster, entryName, version, false
+		}
+	}
+
+	if t == "service" {
+		entryName = strings.Split(m.Source, "/")[2]
+	}
+
+	return t, cluster, entryName, util.CanonicalVersion(version), true
+}
+
+func (f UpdateFilter) matches(name, t, cluster, entryName string) bool {
+	if f.Module != "" && f.Module != name {
+		return false
+	}
+
+	if f.Cluster != "" && f.Cluster != cluster {
+		return false
+	}
+
+	if f.Service != "" && (t != "service" || f.Service != entryName) {
+		return false
+	}
+
+	switch f.Type {
+	case "cluster":
+		return t == "cluster" || t == "elb-dns"
+	case "node-pool":
+		return t == "node_pool"
+	case "service":
+		return t == "service"
+	}
+
+	return true
+}
+
+func (f UpdateFilter) explicitTo() bool {
+	return f.To != "" && f.To != "latest"
+}
+
+// hasVersionTo returns true if the entry of any
+// module matching f has a version matching f.To
+func (s *Stack) hasVersionTo(f UpdateFilter) bool {
+	for _, mods := range s.root.Modules {
+		for _, m := range mods {
+			t, cluster, entryName, _, ok := moduleVersionInfo(m)
+			if !ok || !f.matches(m.Name, t, cluster, entryName) {
+				continue
+			}
+
+			entry, found := s.versionEntry(t, entryName)
+			if !found {
+				continue
+			}
+
+			_, err := entry.GetReleaseOrLatest(f.To)
+			if err == nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *Stack) hasModule(name string) bool {
+	for _, mods := range s.root.Modules {
+		for _, m := range mods {
+			if m.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// jsonModuleUpdates returns an error if any module matching f
+// in the JSON file fn has an update, kbst only edits native syntax
+func (s *Stack) jsonModuleUpdates(fn string, f UpdateFilter) error {
+	for _, m := range s.root.Modules[fn] {
+		_, ok, err := s.moduleUpdate(m, f)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return jsonModuleError(s.root.Path, fn, m.Name)
+		}
+	}
+
+	return nil
+}
+
+func jsonModuleError(root, fn, name string) error {
+	if rel, err := filepath.Rel(root, fn); err == nil {
+		fn = rel
+	}
+
+	return fmt.Errorf("module %q is defined in the JSON file %q, editing modules in JSON files is not supported", name, fn)
+}
+
+func (s *Stack) moduleInFile(fn, name string) (m tfhcl.Module, ok bool) {
+	for _, m := range s.root.Modules[fn] {
+		if m.Name == name {
+			return m, true
+		}
+	}
+
+	return m, false
+}
+
+// setModuleVersion sets the version attribute of b, or
+// the ref of the source, if b has no version attribute
+func setModuleVersion(b *hclwrite.Block, m tfhcl.Module, version string) {
+	if b.Body().GetAttribute("version") != nil {
+		v := strings.TrimPrefix(version, "v")
+		b.Body().SetAttributeValue("version", cty.StringVal(v))
+		return
+	}
+
+	// a source without ref is pinned to version, other
+	// query parameters after the ref are kept
+	prefix, ref, _ := strings.Cut(m.Source, "?ref=")
+	src := prefix + "?ref=" + version
+	if _, rest, ok := strings.Cut(ref, "&"); ok {
+		src += "&" + rest
+	}
+	b.Body().SetAttributeValue("source", cty.StringVal(src))
+}
+
+// versionEntry returns the framework entry for framework
+// modules and the catalog entry for services
+func (s *Stack) versionEntry(t, entryName string) (e util.Entry, ok bool) {
+	if t == "service" {
+		e, ok = s.cliJSON.Catalog[entryName]
+		return e, ok
+	}
+
+	return s.cliJSON.Framework, true
+}
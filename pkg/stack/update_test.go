@@ -0,0 +1,284 @@
+package stack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kbst/kbst/pkg/tfhcl"
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var testUpdateCliJSON = util.CliJSON{
+	Framework: util.Entry{
+		Name: "framework",
+		Versions: []util.Version{
+			{Name: "v0.18.2-beta.0"},
+			{Name: "v0.18.1-beta.0"},
+			{Name: "v0.18.0-beta.0"},
+		},
+	},
+	Catalog: map[string]util.Entry{
+		"nginx": {
+			Name: "nginx",
+			Versions: []util.Version{
+				{Name: "v1.3.2-kbst.0"},
+				{Name: "v1.3.1-kbst.1"},
+			},
+		},
+		"prometheus": {
+			Name: "prometheus",
+			Versions: []util.Version{
+				{Name: "v0.60.1-kbst.1"},
+			},
+		},
+	},
+}
+
+func newTestUpdateStack(t *testing.T) (*Stack, string) {
+	s, p, err := newTestRepoFromFixture("kubestack-starter-multi-4envs")
+	assert.Equal(t, nil, err, nil)
+
+	s.cliJSON = testUpdateCliJSON
+
+	return s, p
+}
+
+func TestUpdateAll(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	updates, _, err := s.Update(UpdateFilter{})
+	assert.Equal(t, nil, err, nil)
+
+	// 3 clusters, 3 node pools, 3 nginx services,
+	// prometheus is newer than latest and not downgraded
+	assert.Len(t, updates, 9, nil)
+
+	for _, c := range s.Clusters() {
+		assert.Equal(t, "v0.18.2-beta.0", c.Version, nil)
+	}
+
+	for _, np := range s.NodePools() {
+		assert.Equal(t, "v0.18.2-beta.0", np.Version, nil)
+	}
+
+	for _, svc := range s.Services() {
+		switch svc.EntryName {
+		case "nginx":
+			assert.Equal(t, "1.3.2-kbst.0", svc.Version, nil)
+		case "prometheus":
+			assert.Equal(t, "0.61.0-kbst.0", svc.Version, nil)
+		}
+	}
+
+	df, _ := os.ReadFile(filepath.Join(p, "Dockerfile"))
+	assert.Equal(t, "FROM kubestack/framework:v0.18.2-beta.0\n", string(df), nil)
+
+	dfl, _ := os.ReadFile(filepath.Join(p, "Dockerfile.loc"))
+	assert.Contains(t, string(dfl), "FROM kubestack/framework:v0.18.2-beta.0-kind\n", nil)
+}
+
+func TestUpdateDockerfileMixedVersions(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	_, warnings, err := s.Update(UpdateFilter{Cluster: "eks_gc0_eu-west-1", Type: "cluster"})
+	assert.Equal(t, nil, err, nil)
+
+	// two clusters remain on the previous version
+	assert.Equal(t, []string{
+		`clusters use mixed framework versions ["v0.18.1-beta.0" "v0.18.2-beta.0"], using "v0.18.2-beta.0" for the Dockerfile`,
+	}, warnings, nil)
+
+	// the newest version in use wins
+	df, _ := os.ReadFile(filepath.Join(p, "Dockerfile"))
+	assert.Equal(t, "FROM kubestack/framework:v0.18.2-beta.0\n", string(df), nil)
+
+	// services do not change the Dockerfile
+	s, p2 := newTestUpdateStack(t)
+	defer os.RemoveAll(p2)
+
+	_, warnings, err = s.Update(UpdateFilter{Type: "service"})
+	assert.Equal(t, nil, err, nil)
+	assert.Empty(t, warnings, nil)
+
+	df, _ = os.ReadFile(filepath.Join(p2, "Dockerfile"))
+	assert.Equal(t, "FROM kubestack/framework:v0.18.1-beta.0\n", string(df), nil)
+}
+
+func TestUpdateFilter(t *testing.T) {
+	cases := map[string]struct {
+		filter UpdateFilter
+		exp    []string
+	}{
+		"cluster": {
+			UpdateFilter{Cluster: "eks_gc0_eu-west-1"},
+			[]string{"eks_gc0_eu-west-1", "eks_gc0_eu-west-1_node_pool_extra", "eks_gc0_eu-west-1_service_nginx"},
+		},
+		"type": {
+			UpdateFilter{Type: "node-pool"},
+			[]string{"aks_gc0_westeurope_node_pool_extra", "eks_gc0_eu-west-1_node_pool_extra", "gke_gc0_europe-west1_node_pool_extra"},
+		},
+		"cluster and type": {
+			UpdateFilter{Cluster: "gke_gc0_europe-west1", Type: "cluster"},
+			[]string{"gke_gc0_europe-west1"},
+		},
+		"service": {
+			UpdateFilter{Service: "nginx", Cluster: "aks_gc0_westeurope"},
+			[]string{"aks_gc0_westeurope_service_nginx"},
+		},
+		"module": {
+			UpdateFilter{Module: "eks_gc0_eu-west-1_node_pool_extra"},
+			[]string{"eks_gc0_eu-west-1_node_pool_extra"},
+		},
+	}
+
+	for name, c := range cases {
+		s, p := newTestUpdateStack(t)
+
+		updates, _, err := s.Update(c.filter)
+		assert.Equal(t, nil, err, name)
+
+		names := []string{}
+		for _, u := range updates {
+			names = append(names, u.Name)
+		}
+		assert.Equal(t, c.exp, names, name)
+
+		os.RemoveAll(p)
+	}
+}
+
+func TestUpdateTo(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	updates, _, err := s.Update(UpdateFilter{Service: "prometheus", To: "0.60.1-kbst.1"})
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, updates, 3, nil)
+	assert.Equal(t, "v0.61.0-kbst.0", updates[0].From, nil)
+	assert.Equal(t, "v0.60.1-kbst.1", updates[0].To, nil)
+
+	_, _, err = s.Update(UpdateFilter{Type: "cluster", To: "v0.1.0"})
+	assert.EqualError(t, err, "aks_gc0_westeurope: 'v0.1.0' is not a valid version, try the latest version 'v0.18.2-beta.0'", nil)
+}
+
+func TestUpdateToMixed(t *testing.T) {
+	// a framework version only applies to framework modules
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	updates, _, err := s.Update(UpdateFilter{Cluster: "eks_gc0_eu-west-1", To: "v0.18.2-beta.0"})
+	assert.Equal(t, nil, err, nil)
+
+	names := []string{}
+	for _, u := range updates {
+		names = append(names, u.Name)
+		assert.Equal(t, "v0.18.2-beta.0", u.To, u.Name)
+	}
+	assert.Equal(t, []string{"eks_gc0_eu-west-1", "eks_gc0_eu-west-1_node_pool_extra"}, names, nil)
+
+	// a catalog version only applies to services having it
+	s, p2 := newTestUpdateStack(t)
+	defer os.RemoveAll(p2)
+
+	updates, _, err = s.Update(UpdateFilter{To: "1.3.2-kbst.0"})
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, updates, 3, nil)
+	for _, u := range updates {
+		assert.Contains(t, u.Name, "_service_nginx", nil)
+	}
+
+	// a version no entry has still fails
+	_, _, err = s.Update(UpdateFilter{To: "v9.9.9"})
+	assert.ErrorContains(t, err, "'v9.9.9' is not a valid version", nil)
+}
+
+func TestUpdateInvalid(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	_, _, err := s.Update(UpdateFilter{Type: "no-such-type"})
+	assert.EqualError(t, err, "invalid type \"no-such-type\", choose one of [\"cluster\" \"node-pool\" \"service\"]", nil)
+
+	_, _, err = s.Update(UpdateFilter{Module: "no_such_module"})
+	assert.EqualError(t, err, "no module named \"no_such_module\" found", nil)
+}
+
+func TestUpdateJSONModule(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	os.Remove(filepath.Join(p, "eks_gc0_eu-west-1_service_nginx.tf"))
+	os.WriteFile(filepath.Join(p, "eks_gc0_eu-west-1_service_nginx.tf.json"), []byte(`{
+  "module": {
+    "eks_gc0_eu-west-1_service_nginx": {
+      "providers": {"kustomization": "kustomization.eks_gc0_eu-west-1"},
+      "source": "kbst.xyz/catalog/nginx/kustomization",
+      "version": "1.3.1-kbst.1",
+      "configuration_base_key": "apps-prd",
+      "configuration": {"apps-prd": {}, "apps-stg": {}, "ops": {}, "apps-dev": {}}
+    }
+  }
+}`), 0644)
+
+	err := s.FromPath()
+	assert.Equal(t, nil, err, nil)
+
+	found := false
+	for _, svc := range s.Services() {
+		if svc.Name() == "eks_gc0_eu-west-1_service_nginx" {
+			found = true
+			assert.Equal(t, "1.3.1-kbst.1", svc.Version, nil)
+		}
+	}
+	assert.True(t, found, nil)
+
+	_, _, err = s.Update(UpdateFilter{Service: "nginx"})
+	assert.EqualError(t, err, `module "eks_gc0_eu-west-1_service_nginx" is defined in the JSON file "eks_gc0_eu-west-1_service_nginx.tf.json", editing modules in JSON files is not supported`, nil)
+
+	// modules in native syntax files are still updated
+	updates, _, err := s.Update(UpdateFilter{Type: "cluster"})
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, updates, 3, nil)
+}
+
+func TestSetModuleVersion(t *testing.T) {
+	cases := []struct {
+		source   string
+		expected string
+	}{
+		{
+			source:   "github.com/kbst/terraform-kubestack//aws/cluster?ref=v0.18.1-beta.0",
+			expected: "github.com/kbst/terraform-kubestack//aws/cluster?ref=v0.18.2-beta.0",
+		},
+		{
+			// the current ref also appears in the path
+			source:   "github.com/kbst/v0.18.1-beta.0//aws/cluster?ref=v0.18.1-beta.0",
+			expected: "github.com/kbst/v0.18.1-beta.0//aws/cluster?ref=v0.18.2-beta.0",
+		},
+		{
+			source:   "github.com/kbst/terraform-kubestack//aws/cluster",
+			expected: "github.com/kbst/terraform-kubestack//aws/cluster?ref=v0.18.2-beta.0",
+		},
+		{
+			source:   "git::https://github.com/kbst/terraform-kubestack.git//aws/cluster?ref=v0.18.1-beta.0&depth=1",
+			expected: "git::https://github.com/kbst/terraform-kubestack.git//aws/cluster?ref=v0.18.2-beta.0&depth=1",
+		},
+	}
+
+	for _, c := range cases {
+		f := hclwrite.NewEmptyFile()
+		b := f.Body().AppendNewBlock("module", []string{"eks_test"})
+		b.Body().SetAttributeValue("source", cty.StringVal(c.source))
+
+		setModuleVersion(b, tfhcl.Module{Source: c.source}, "v0.18.2-beta.0")
+
+		expected := hclwrite.TokensForValue(cty.StringVal(c.expected)).Bytes()
+		assert.Equal(t, string(expected), string(b.Body().GetAttribute("source").Expr().BuildTokens(nil).Bytes()), c.source)
+	}
+}
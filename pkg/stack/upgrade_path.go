@@ -0,0 +1,167 @@
+package stack
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/kbst/kbst/pkg/util"
+	"golang.org/x/exp/slices"
+	"golang.org/x/mod/semver"
+)
+
+// ProjectConfigFile is the name of the optional
+// project configuration in the root of the repository
+const ProjectConfigFile = "kbst.hcl"
+
+// ProjectConfig is the project configuration,
+// read from ProjectConfigFile
+type ProjectConfig struct {
+	// Channel restricts framework and catalog versions
+	// to stable, beta or dev, unless set by flag
+	Channel string `hcl:"channel,optional"`
+
+	// Directories lists directories, relative to the repository
+	// root, whose modules belong to the stack too, entries may
+	// be glob patterns, e.g. "clusters/*"
+	Directories []string `hcl:"directories,optional"`
+
+	Update *UpgradePolicy `hcl:"update,block"`
+}
+
+// UpgradePolicy restricts the framework versions update
+// upgrades to and how far it upgrades in a single step
+type UpgradePolicy struct {
+	// AllowPrerelease allows upgrading to pre-releases
+	// from stable versions, modules already on a
+	// pre-release may always upgrade to pre-releases
+	AllowPrerelease bool `hcl:"allow_prerelease,optional"`
+
+	// MaxMinorBump is the maximum number of minor versions
+	// to upgrade in a single step, 0 means no limit
+	MaxMinorBump int `hcl:"max_minor_bump,optional"`
+
+	// Required versions can not be skipped, in addition
+	// to the versions marked required in the cli.json
+	Required []string `hcl:"required,optional"`
+}
+
+// ProjectConfig returns the project configuration,
+// a missing ProjectConfigFile returns the defaults
+func (s *Stack) ProjectConfig() (pc ProjectConfig, err error) {
+	f, ok := s.root.Parser.Files()[filepath.Join(s.root.Path, ProjectConfigFile)]
+	if !ok {
+		return pc, nil
+	}
+
+	diags := gohcl.DecodeBody(f.Body, nil, &pc)
+	if diags.HasErrors() {
+		return pc, diags
+	}
+
+	if pc.Channel != "" {
+		err = util.ValidateChannel(pc.Channel)
+		if err != nil {
+			return pc, fmt.Errorf("%s: %s", ProjectConfigFile, err)
+		}
+	}
+
+	if pc.Update != nil && pc.Update.MaxMinorBump < 0 {
+		return pc, fmt.Errorf("%s: max_minor_bump must not be negative", ProjectConfigFile)
+	}
+
+	return pc, nil
+}
+
+// upgradePath returns the versions to upgrade through from
+// from to to, one step each, following policy p, explicit
+// targets are allowed even if they are pre-releases
+func upgradePath(versions []util.Version, from, to string, explicit bool, p UpgradePolicy) (path []string) {
+	required := []string{}
+	for _, r := range p.Required {
+		required = append(required, util.CanonicalVersion(r))
+	}
+
+	candidates := []string{}
+	for _, v := range versions {
+		n := util.CanonicalVersion(v.Name)
+		if !semver.IsValid(n) {
+			continue
+		}
+
+		if semver.Compare(from, n) >= 0 || semver.Compare(n, to) > 0 {
+			continue
+		}
+
+		if semver.Prerelease(n) != "" && !p.allowsPrerelease(from) && !(explicit && n == to) {
+			continue
+		}
+
+		if v.Required {
+			required = append(required, n)
+		}
+
+		candidates = append(candidates, n)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return semver.Compare(candidates[i], candidates[j]) < 0
+	})
+
+	current := from
+	for len(candidates) > 0 {
+		// never step over a required version
+		limit := len(candidates) - 1
+		for i, c := range candidates {
+			if slices.Contains(required, c) {
+				limit = i
+				break
+			}
+		}
+
+		// the furthest step within the minor bump limit,
+		// or the next version if none is within the limit
+		next := 0
+		for i := limit; i >= 0; i-- {
+			if p.withinMinorBump(current, candidates[i]) {
+				next = i
+				break
+			}
+		}
+
+		current = candidates[next]
+		path = append(path, current)
+		candidates = candidates[next+1:]
+	}
+
+	return path
+}
+
+func (p UpgradePolicy) allowsPrerelease(from string) bool {
+	return p.AllowPrerelease || semver.Prerelease(from) != ""
+}
+
+func (p UpgradePolicy) withinMinorBump(from, to string) bool {
+	if p.MaxMinorBump == 0 {
+		return true
+	}
+
+	if semver.Major(from) != semver.Major(to) {
+		return false
+	}
+
+	return minor(to)-minor(from) <= p.MaxMinorBump
+}
+
+func minor(v string) int {
+	mm := strings.Split(semver.MajorMinor(v), ".")
+	if len(mm) != 2 {
+		return 0
+	}
+
+	m, _ := strconv.Atoi(mm[1])
+	return m
+}
@@ -0,0 +1,214 @@
+package stack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kbst/kbst/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var testUpgradeVersions = []util.Version{
+	{Name: "v1.3.0-rc.1"},
+	{Name: "v1.2.1"},
+	{Name: "v1.2.0"},
+	{Name: "v1.1.0", Required: true},
+	{Name: "v1.0.1"},
+	{Name: "v1.0.0"},
+	{Name: "v0.9.0"},
+}
+
+func TestUpgradePath(t *testing.T) {
+	cases := []struct {
+		name     string
+		from     string
+		to       string
+		explicit bool
+		policy   UpgradePolicy
+		expected []string
+	}{
+		{
+			name:     "stable only, stops at required",
+			from:     "v1.0.0",
+			to:       "v1.3.0-rc.1",
+			expected: []string{"v1.1.0", "v1.2.1"},
+		},
+		{
+			name:     "allow prerelease",
+			from:     "v1.1.0",
+			to:       "v1.3.0-rc.1",
+			policy:   UpgradePolicy{AllowPrerelease: true},
+			expected: []string{"v1.3.0-rc.1"},
+		},
+		{
+			name:     "explicit prerelease target",
+			from:     "v1.1.0",
+			to:       "v1.3.0-rc.1",
+			explicit: true,
+			expected: []string{"v1.3.0-rc.1"},
+		},
+		{
+			name:     "from prerelease",
+			from:     "v1.1.0-rc.1",
+			to:       "v1.3.0-rc.1",
+			expected: []string{"v1.1.0", "v1.3.0-rc.1"},
+		},
+		{
+			name:     "max minor bump",
+			from:     "v1.1.0",
+			to:       "v1.2.1",
+			policy:   UpgradePolicy{MaxMinorBump: 1},
+			expected: []string{"v1.2.1"},
+		},
+		{
+			name:     "max minor bump across major",
+			from:     "v0.9.0",
+			to:       "v1.2.1",
+			policy:   UpgradePolicy{MaxMinorBump: 1},
+			expected: []string{"v1.0.0", "v1.1.0", "v1.2.1"},
+		},
+		{
+			name:     "required from policy",
+			from:     "v1.1.0",
+			to:       "v1.2.1",
+			policy:   UpgradePolicy{Required: []string{"1.2.0"}},
+			expected: []string{"v1.2.0", "v1.2.1"},
+		},
+		{
+			name:     "up to date",
+			from:     "v1.2.1",
+			to:       "v1.2.1",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := upgradePath(testUpgradeVersions, tc.from, tc.to, tc.explicit, tc.policy)
+			assert.Equal(t, tc.expected, path, nil)
+		})
+	}
+}
+
+func TestProjectConfig(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	pc, err := s.ProjectConfig()
+	assert.Equal(t, nil, err, nil)
+	assert.Nil(t, pc.Update, nil)
+
+	cfg := `update {
+  allow_prerelease = true
+  max_minor_bump   = 1
+  required         = ["v0.18.1-beta.0"]
+}
+`
+	err = os.WriteFile(filepath.Join(p, ProjectConfigFile), []byte(cfg), 0644)
+	assert.Equal(t, nil, err, nil)
+
+	err = s.FromPath()
+	assert.Equal(t, nil, err, nil)
+
+	pc, err = s.ProjectConfig()
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, &UpgradePolicy{
+		AllowPrerelease: true,
+		MaxMinorBump:    1,
+		Required:        []string{"v0.18.1-beta.0"},
+	}, pc.Update, nil)
+}
+
+func TestUpdateUpgradePath(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	s.cliJSON.Framework.Versions = []util.Version{
+		{Name: "v0.18.3-beta.0"},
+		{Name: "v0.18.2-beta.0", Required: true},
+		{Name: "v0.18.1-beta.0"},
+	}
+
+	updates, _, err := s.Update(UpdateFilter{Module: "eks_gc0_eu-west-1"})
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, updates, 1, nil)
+	assert.Equal(t, "v0.18.2-beta.0", updates[0].To, nil)
+	assert.Equal(t, []string{"v0.18.2-beta.0", "v0.18.3-beta.0"}, updates[0].Path, nil)
+
+	updates, _, err = s.Update(UpdateFilter{Module: "eks_gc0_eu-west-1"})
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, updates, 1, nil)
+	assert.Equal(t, "v0.18.3-beta.0", updates[0].To, nil)
+}
+
+func TestProjectConfigChannel(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	err := os.WriteFile(filepath.Join(p, ProjectConfigFile), []byte("channel = \"stable\"\n"), 0644)
+	assert.Equal(t, nil, err, nil)
+
+	err = s.FromPath()
+	assert.Equal(t, nil, err, nil)
+
+	// all test framework versions are beta
+	assert.Equal(t, "stable", s.cliJSON.Channel, nil)
+	assert.Len(t, s.cliJSON.Framework.Versions, 0, nil)
+	assert.Len(t, s.cliJSON.Catalog["nginx"].Versions, 2, nil)
+
+	updates, _, err := s.Update(UpdateFilter{Type: "cluster"})
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, updates, 0, nil)
+}
+
+func TestProjectConfigInvalidChannel(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	err := os.WriteFile(filepath.Join(p, ProjectConfigFile), []byte("channel = \"nightly\"\n"), 0644)
+	assert.Equal(t, nil, err, nil)
+
+	err = s.FromPath()
+	assert.ErrorContains(t, err, "kbst.hcl: invalid channel 'nightly'", nil)
+}
+
+func TestProjectConfigDirectories(t *testing.T) {
+	s, p := newTestUpdateStack(t)
+	defer os.RemoveAll(p)
+
+	svc := "eks_gc0_eu-west-1_service_nginx.tf"
+	os.MkdirAll(filepath.Join(p, "clusters", "eks"), 0755)
+	err := os.Rename(filepath.Join(p, svc), filepath.Join(p, "clusters", "eks", svc))
+	assert.Equal(t, nil, err, nil)
+
+	os.MkdirAll(filepath.Join(p, "modules", "dns"), 0755)
+	os.WriteFile(filepath.Join(p, "modules", "dns", "variables.tf"), []byte("variable \"zone\" {}\nvariable \"ttl\" {\n  default = 300\n}\n"), 0644)
+	os.WriteFile(filepath.Join(p, "custom_dns.tf"), []byte("module \"dns\" {\n  source = \"./modules/dns\"\n  zone   = \"example.com\"\n}\n"), 0644)
+
+	err = s.FromPath()
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, s.Services(), 8, nil)
+
+	err = os.WriteFile(filepath.Join(p, ProjectConfigFile), []byte("directories = [\"clusters/*\"]\n"), 0644)
+	assert.Equal(t, nil, err, nil)
+
+	err = s.FromPath()
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, s.Services(), 9, nil)
+
+	mods := s.Modules()
+	assert.Len(t, mods, 1, nil)
+	assert.Equal(t, "./modules/dns", mods[0].Source(), nil)
+	assert.Equal(t, []string{"ttl", "zone"}, mods[0].Inputs(), nil)
+
+	// modules are updated in the file they are defined in
+	_, _, err = s.Update(UpdateFilter{Module: "eks_gc0_eu-west-1_service_nginx"})
+	assert.Equal(t, nil, err, nil)
+
+	d, _ := os.ReadFile(filepath.Join(p, "clusters", "eks", svc))
+	assert.Contains(t, string(d), `version = "1.3.2-kbst.0"`, nil)
+
+	_, err = os.Stat(filepath.Join(p, svc))
+	assert.True(t, os.IsNotExist(err), nil)
+}
@@ -1,6 +1,9 @@
 package stack
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/kbst/kbst/pkg/tfhcl"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -56,3 +59,77 @@ func convertToTfhclConfiguration(in []Configuration) (out []tfhcl.Configuration)
 
 	return out
 }
+
+// effectiveAttributes returns the attributes of environment env
+// merged on top of the inherited base environment attributes
+func effectiveAttributes(cfgs []Configuration, env string) (attrs map[string]cty.Value, err error) {
+	if len(cfgs) == 0 {
+		return attrs, fmt.Errorf("invalid empty configuration %+v", cfgs)
+	}
+
+	attrs = make(map[string]cty.Value)
+	for k, v := range cfgs[0].Attributes {
+		attrs[k] = v
+	}
+
+	if env == cfgs[0].EnvironmentKey {
+		return attrs, nil
+	}
+
+	for _, cfg := range cfgs[1:] {
+		if cfg.EnvironmentKey != env {
+			continue
+		}
+
+		for k, v := range cfg.Attributes {
+			attrs[k] = v
+		}
+
+		return attrs, nil
+	}
+
+	return attrs, fmt.Errorf("no configuration for environment %q", env)
+}
+
+// nodeShape reads the instance type and node count
+// attributes from attrs using the given attribute names
+func nodeShape(attrs map[string]cty.Value, instanceType, minNodes, maxNodes string) (ns NodeShape) {
+	if v, ok := attrs[instanceType]; ok {
+		ns.InstanceType = strings.Join(instanceTypes(v), ",")
+	}
+
+	if v, ok := attrs[minNodes]; ok && v.Type() == cty.Number && v.IsKnown() && !v.IsNull() {
+		ns.MinNodes, _ = v.AsBigFloat().Int64()
+	}
+
+	if v, ok := attrs[maxNodes]; ok && v.Type() == cty.Number && v.IsKnown() && !v.IsNull() {
+		ns.MaxNodes, _ = v.AsBigFloat().Int64()
+	}
+
+	return ns
+}
+
+// instanceTypes returns the instance types of v, set either
+// as a comma separated string or as a list or tuple of strings,
+// unknown, null and non string values are skipped
+func instanceTypes(v cty.Value) (its []string) {
+	if !v.IsKnown() || v.IsNull() {
+		return its
+	}
+
+	t := v.Type()
+	switch {
+	case t == cty.String:
+		if v.AsString() != "" {
+			its = strings.Split(v.AsString(), ",")
+		}
+	case t.IsListType() || t.IsTupleType():
+		for _, e := range v.AsValueSlice() {
+			if e.Type() == cty.String && e.IsKnown() && !e.IsNull() {
+				its = append(its, e.AsString())
+			}
+		}
+	}
+
+	return its
+}
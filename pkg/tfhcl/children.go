@@ -0,0 +1,110 @@
+package tfhcl
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IsLocal returns true if the module's source
+// is a directory relative to the calling module
+func (m *Module) IsLocal() bool {
+	return strings.HasPrefix(m.Source, "./") || strings.HasPrefix(m.Source, "../")
+}
+
+// Inputs returns the variables of the child root
+// of the module name, sorted by name
+func (r *Root) Inputs(name string) (inputs []Variable, ok bool) {
+	c, ok := r.Children[name]
+	if !ok {
+		return inputs, false
+	}
+
+	for _, vs := range c.Variables {
+		inputs = append(inputs, vs...)
+	}
+
+	sort.Slice(inputs, func(i, j int) bool {
+		return inputs[i].Name < inputs[j].Name
+	})
+
+	return inputs, true
+}
+
+// readChildren reads the directories of all modules with a local
+// source as roots of their own, modules sharing a directory
+// share the child root, calling an ancestor is an error
+func (r *Root) readChildren() error {
+	byDir := map[string]*Root{}
+
+	fns := []string{}
+	for fn := range r.Modules {
+		fns = append(fns, fn)
+	}
+	sort.Strings(fns)
+
+	for _, fn := range fns {
+		for _, m := range r.Modules[fn] {
+			if !m.IsLocal() {
+				continue
+			}
+
+			dir := filepath.Join(filepath.Dir(fn), filepath.FromSlash(m.Source))
+			if c, ok := byDir[dir]; ok {
+				r.Children[m.Name] = c
+				continue
+			}
+
+			for p := r; p != nil; p = p.parent {
+				if filepath.Clean(p.Path) == dir {
+					return fmt.Errorf("module %q: source %q calls a module calling it", m.Name, m.Source)
+				}
+			}
+
+			fsys, err := r.childFS(dir)
+			if err != nil {
+				return fmt.Errorf("module %q: %s", m.Name, err)
+			}
+
+			c := NewRootFS(dir, fsys)
+			c.parent = r
+
+			err = c.Read()
+			if err != nil {
+				return fmt.Errorf("module %q: %w", m.Name, err)
+			}
+
+			byDir[dir] = c
+			r.Children[m.Name] = c
+		}
+	}
+
+	return nil
+}
+
+// childFS returns the FS of dir, roots on disk can read
+// directories outside of Path, other roots only directories
+// inside the Path of the root all children descend from
+func (r *Root) childFS(dir string) (FS, error) {
+	top := r
+	for top.parent != nil {
+		top = top.parent
+	}
+
+	if _, ok := top.fsys.(dirFS); ok {
+		return DirFS(dir), nil
+	}
+
+	name, err := top.name(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fs.ValidPath(name) {
+		return nil, fmt.Errorf("source directory %q is outside of the root", dir)
+	}
+
+	return subFS{fsys: top.fsys, dir: name}, nil
+}
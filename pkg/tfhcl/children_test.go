@@ -0,0 +1,122 @@
+package tfhcl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadChildren(t *testing.T) {
+	r := NewRootFS("/repo", NewMemFS(map[string][]byte{
+		"main.tf": []byte(`
+module "dns" {
+  source = "./modules/dns"
+  zone   = "example.com"
+}
+
+module "dns_other" {
+  source = "./modules/dns"
+  zone   = "example.org"
+}
+`),
+		"modules/dns/variables.tf": []byte(`
+variable "zone" {}
+
+variable "ttl" {
+  default = 300
+}
+`),
+		"modules/dns/main.tf": []byte(`
+module "record" {
+  source = "../record"
+}
+`),
+		"modules/record/variables.tf": []byte(`variable "name" {}`),
+	}))
+
+	err := r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	assert.Len(t, r.Children, 2, nil)
+	assert.Same(t, r.Children["dns"], r.Children["dns_other"], nil)
+	assert.Equal(t, "/repo/modules/dns", r.Children["dns"].Path, nil)
+
+	inputs, ok := r.Inputs("dns")
+	assert.True(t, ok, nil)
+	assert.Len(t, inputs, 2, nil)
+	assert.Equal(t, "ttl", inputs[0].Name, nil)
+	assert.Equal(t, "zone", inputs[1].Name, nil)
+
+	inputs, ok = r.Children["dns"].Inputs("record")
+	assert.True(t, ok, nil)
+	assert.Len(t, inputs, 1, nil)
+
+	_, ok = r.Inputs("no_such_module")
+	assert.False(t, ok, nil)
+}
+
+func TestReadChildrenInvalid(t *testing.T) {
+	cases := map[string]struct {
+		files map[string][]byte
+		err   string
+	}{
+		"cycle": {
+			files: map[string][]byte{
+				"main.tf":          []byte(`module "a" { source = "./a" }`),
+				"a/main.tf":        []byte(`module "b" { source = "./b" }`),
+				"a/b/main.tf":      []byte(`module "a" { source = "../" }`),
+				"a/b/variables.tf": []byte(`variable "x" {}`),
+			},
+			err: `module "a": module "b": module "a": source "../" calls a module calling it`,
+		},
+		"outside": {
+			files: map[string][]byte{
+				"main.tf": []byte(`module "a" { source = "../a" }`),
+			},
+			err: `module "a": source directory "/a" is outside of the root`,
+		},
+		"missing": {
+			files: map[string][]byte{
+				"main.tf": []byte(`module "a" { source = "./a" }`),
+			},
+			err: `module "a": open a: file does not exist`,
+		},
+	}
+
+	for name, tc := range cases {
+		r := NewRootFS("/repo", NewMemFS(tc.files))
+		err := r.Read()
+		assert.EqualError(t, err, tc.err, name)
+	}
+}
+
+func TestReadDirs(t *testing.T) {
+	r := NewRootFS("/repo", NewMemFS(map[string][]byte{
+		"variables.tf":                  []byte(`variable "base_domain" {}`),
+		"config.auto.tfvars":            []byte(`base_domain = "example.com"`),
+		"clusters/eks/cluster.tf":       []byte(`module "eks" { source = "eks" }`),
+		"clusters/eks/README.md":        []byte(`# not parsed`),
+		"clusters/aks/cluster.tf.json":  []byte(`{"module": {"aks": {"source": "aks"}}}`),
+		"clusters/.hidden/cluster.tf":   []byte(`module "hidden" { source = "hidden" }`),
+		"clusters/gke/terraform.tfvars": []byte(`gke_only = true`),
+	}))
+	r.Dirs = []string{"clusters/*"}
+
+	err := r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	assert.Len(t, r.Modules["/repo/clusters/eks/cluster.tf"], 1, nil)
+	assert.Len(t, r.Modules["/repo/clusters/aks/cluster.tf.json"], 1, nil)
+	_, ok := r.Modules["/repo/clusters/.hidden/cluster.tf"]
+	assert.False(t, ok, nil)
+	_, ok = r.Parser.Files()["/repo/clusters/eks/README.md"]
+	assert.False(t, ok, nil)
+
+	v, ok := r.GetVariableValue("gke_only")
+	assert.True(t, ok, nil)
+	assert.True(t, v.True(), nil)
+
+	r.Dirs = []string{"no-such-dir"}
+	err = r.Read()
+	assert.EqualError(t, err, `no directory matches "no-such-dir"`, nil)
+}
@@ -0,0 +1,146 @@
+package tfhcl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/exp/maps"
+)
+
+// FileChange is a pending change of a single file,
+// From is nil for created and To is nil for deleted files
+type FileChange struct {
+	Path string
+	Mode fs.FileMode
+	From []byte
+	To   []byte
+}
+
+func (c FileChange) Created() bool {
+	return c.From == nil
+}
+
+func (c FileChange) Deleted() bool {
+	return c.To == nil
+}
+
+// Changes returns the changes kept in the overlay
+// of a dry-run, with paths relative to the root
+func (r *Root) Changes() (changes []FileChange, err error) {
+	paths := maps.Keys(r.overlay)
+	sort.Strings(paths)
+
+	for _, fp := range paths {
+		o := r.overlay[fp]
+
+		name, err := r.name(fp)
+		if err != nil {
+			return changes, err
+		}
+
+		c := FileChange{
+			Path: name,
+			Mode: 0644,
+		}
+
+		if fi, err := r.fsys.Stat(name); err == nil {
+			c.Mode = fi.Mode()
+			c.From, err = r.fsys.ReadFile(name)
+			if err != nil {
+				return changes, err
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return changes, err
+		}
+
+		if !o.deleted {
+			c.To = o.data
+			if c.To == nil {
+				c.To = []byte{}
+			}
+		}
+
+		if c.Created() && c.Deleted() {
+			continue
+		}
+
+		if c.From != nil && c.To != nil && bytes.Equal(c.From, c.To) {
+			continue
+		}
+
+		changes = append(changes, c)
+	}
+
+	return changes, nil
+}
+
+// UnifiedDiff renders changes as a unified diff,
+// if patch is true, the output can be applied using git apply
+func UnifiedDiff(changes []FileChange, patch bool) (string, error) {
+	var b strings.Builder
+
+	for _, c := range changes {
+		from, to := c.Path, c.Path
+		if patch {
+			from, to = fmt.Sprintf("a/%s", c.Path), fmt.Sprintf("b/%s", c.Path)
+
+			fmt.Fprintf(&b, "diff --git %s %s\n", from, to)
+			if c.Created() {
+				fmt.Fprintf(&b, "new file mode %s\n", gitMode(c.Mode))
+			}
+			if c.Deleted() {
+				fmt.Fprintf(&b, "deleted file mode %s\n", gitMode(c.Mode))
+			}
+		}
+
+		if c.Created() {
+			from = "/dev/null"
+		}
+		if c.Deleted() {
+			to = "/dev/null"
+		}
+
+		d := difflib.UnifiedDiff{
+			A:        splitLines(c.From),
+			B:        splitLines(c.To),
+			FromFile: from,
+			ToFile:   to,
+			Context:  3,
+		}
+
+		err := difflib.WriteUnifiedDiff(&b, d)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return b.String(), nil
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] += "\n"
+	}
+
+	return lines
+}
+
+func gitMode(m fs.FileMode) string {
+	if m&0111 != 0 {
+		return "100755"
+	}
+
+	return "100644"
+}
@@ -0,0 +1,109 @@
+package tfhcl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunChanges(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	err = os.WriteFile(filepath.Join(p, "changed.tf"), []byte("# a\n# b\n"), 0644)
+	assert.Equal(t, nil, err, nil)
+	err = os.WriteFile(filepath.Join(p, "deleted.tf"), []byte("# deleted\n"), 0644)
+	assert.Equal(t, nil, err, nil)
+
+	r := NewRoot(p)
+	r.DryRun = true
+	err = r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	r.WriteFiles(map[string][]byte{
+		"changed.tf": []byte("# a\n# c\n"),
+		"created.tf": []byte("# created\n"),
+	})
+	r.DeleteFiles([]string{filepath.Join(p, "deleted.tf")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	// the overlay is visible after re-reading
+	_, ok := r.Parser.Files()[filepath.Join(p, "created.tf")]
+	assert.True(t, ok, nil)
+	_, ok = r.Parser.Files()[filepath.Join(p, "deleted.tf")]
+	assert.False(t, ok, nil)
+
+	// the disk is untouched
+	d, _ := os.ReadFile(filepath.Join(p, "changed.tf"))
+	assert.Equal(t, "# a\n# b\n", string(d), nil)
+	_, err = os.Stat(filepath.Join(p, "created.tf"))
+	assert.True(t, os.IsNotExist(err), nil)
+	_, err = os.Stat(filepath.Join(p, "deleted.tf"))
+	assert.Equal(t, nil, err, nil)
+
+	changes, err := r.Changes()
+	assert.Equal(t, nil, err, nil)
+
+	diff, err := UnifiedDiff(changes, false)
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, `--- changed.tf
++++ changed.tf
+@@ -1,2 +1,2 @@
+ # a
+-# b
++# c
+--- /dev/null
++++ created.tf
+@@ -0,0 +1 @@
++# created
+--- deleted.tf
++++ /dev/null
+@@ -1 +0,0 @@
+-# deleted
+`, diff, nil)
+
+	patch, err := UnifiedDiff(changes, true)
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, `diff --git a/changed.tf b/changed.tf
+--- a/changed.tf
++++ b/changed.tf
+@@ -1,2 +1,2 @@
+ # a
+-# b
++# c
+diff --git a/created.tf b/created.tf
+new file mode 100644
+--- /dev/null
++++ b/created.tf
+@@ -0,0 +1 @@
++# created
+diff --git a/deleted.tf b/deleted.tf
+deleted file mode 100644
+--- a/deleted.tf
++++ /dev/null
+@@ -1 +0,0 @@
+-# deleted
+`, patch, nil)
+}
+
+func TestDryRunDeleteNotExist(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	r := NewRoot(p)
+	r.DryRun = true
+
+	r.WriteFiles(map[string][]byte{"created.tf": []byte("# created\n")})
+	r.DeleteFiles([]string{filepath.Join(p, "does-not-exist.tf")})
+	err = r.Write()
+	assert.ErrorIs(t, err, os.ErrNotExist, nil)
+
+	changes, err := r.Changes()
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, changes, 0, nil)
+}
@@ -0,0 +1,389 @@
+package tfhcl
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// FS is the filesystem a Root reads from and writes to, names
+// are slash separated and relative to the root, as for fs.FS
+type FS interface {
+	fs.ReadDirFS
+	fs.ReadFileFS
+	fs.StatFS
+
+	// WriteFile creates or replaces the file name, its
+	// permissions are perm, regardless of the umask
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Rename(oldname, newname string) error
+	Remove(name string) error
+	MkdirAll(name string, perm fs.FileMode) error
+}
+
+// ErrReadOnly is returned by writes to a ReadOnlyFS
+var ErrReadOnly = errors.New("read-only filesystem")
+
+// DirFS returns the FS of the directory dir on disk
+func DirFS(dir string) FS {
+	return dirFS(dir)
+}
+
+type dirFS string
+
+func (d dirFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return filepath.Join(string(d), filepath.FromSlash(name)), nil
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	return os.DirFS(string(d)).Open(name)
+}
+
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := d.join("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadDir(p)
+}
+
+func (d dirFS) ReadFile(name string) ([]byte, error) {
+	p, err := d.join("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(p)
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := d.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Lstat(p)
+}
+
+func (d dirFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	p, err := d.join("writefile", name)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(p, data, perm)
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(p, perm)
+}
+
+func (d dirFS) Rename(oldname, newname string) error {
+	op, err := d.join("rename", oldname)
+	if err != nil {
+		return err
+	}
+
+	np, err := d.join("rename", newname)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(op, np)
+}
+
+func (d dirFS) Remove(name string) error {
+	p, err := d.join("remove", name)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(p)
+}
+
+func (d dirFS) MkdirAll(name string, perm fs.FileMode) error {
+	p, err := d.join("mkdir", name)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(p, perm)
+}
+
+// MemFS is an in-memory FS, directories are implied
+// by the files in them or created with MkdirAll
+type MemFS struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+}
+
+// NewMemFS returns a MemFS holding files
+func NewMemFS(files map[string][]byte) *MemFS {
+	m := &MemFS{files: fstest.MapFS{}}
+	for name, data := range files {
+		m.files[name] = &fstest.MapFile{Data: data, Mode: 0644, ModTime: time.Now()}
+	}
+
+	return m
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.files.Open(name)
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.files.ReadDir(name)
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := m.files.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// callers must not change the stored data
+	return append([]byte{}, data...), nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.files.Stat(name)
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "writefile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, ok := m.files[name]; ok && f.Mode.IsDir() {
+		return &fs.PathError{Op: "writefile", Path: name, Err: errors.New("is a directory")}
+	}
+
+	m.files[name] = &fstest.MapFile{
+		Data:    append([]byte{}, data...),
+		Mode:    perm.Perm(),
+		ModTime: time.Now(),
+	}
+
+	return nil
+}
+
+func (m *MemFS) Rename(oldname, newname string) error {
+	if !fs.ValidPath(newname) {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[oldname]
+	if !ok || f.Mode.IsDir() {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+
+	delete(m.files, oldname)
+	m.files[newname] = f
+
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+
+	prefix := name + "/"
+	for n := range m.files {
+		if strings.HasPrefix(n, prefix) {
+			return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+		}
+	}
+
+	delete(m.files, name)
+
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for d := name; d != "."; d = path.Dir(d) {
+		if f, ok := m.files[d]; ok {
+			if !f.Mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: d, Err: errors.New("not a directory")}
+			}
+			continue
+		}
+
+		m.files[d] = &fstest.MapFile{Mode: fs.ModeDir | perm.Perm(), ModTime: time.Now()}
+	}
+
+	return nil
+}
+
+// Files returns the names of all files in m, sorted
+func (m *MemFS) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := []string{}
+	for n, f := range m.files {
+		if !f.Mode.IsDir() {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ReadOnlyFS returns fsys as an FS, writes return ErrReadOnly,
+// use it to load stacks from zip archives or git trees
+func ReadOnlyFS(fsys fs.FS) FS {
+	return readOnlyFS{fsys}
+}
+
+type readOnlyFS struct {
+	fsys fs.FS
+}
+
+func (r readOnlyFS) Open(name string) (fs.File, error) {
+	return r.fsys.Open(name)
+}
+
+func (r readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(r.fsys, name)
+}
+
+func (r readOnlyFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(r.fsys, name)
+}
+
+func (r readOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(r.fsys, name)
+}
+
+func (r readOnlyFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return &fs.PathError{Op: "writefile", Path: name, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Rename(oldname, newname string) error {
+	return &fs.PathError{Op: "rename", Path: oldname, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) MkdirAll(name string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: ErrReadOnly}
+}
+
+// subFS is the FS of the directory dir of fsys
+type subFS struct {
+	fsys FS
+	dir  string
+}
+
+func (s subFS) join(name string) string {
+	return path.Join(s.dir, name)
+}
+
+func (s subFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return s.fsys.Open(s.join(name))
+}
+
+func (s subFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return s.fsys.ReadDir(s.join(name))
+}
+
+func (s subFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return s.fsys.ReadFile(s.join(name))
+}
+
+func (s subFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return s.fsys.Stat(s.join(name))
+}
+
+func (s subFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "writefile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return s.fsys.WriteFile(s.join(name), data, perm)
+}
+
+func (s subFS) Rename(oldname, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrInvalid}
+	}
+
+	return s.fsys.Rename(s.join(oldname), s.join(newname))
+}
+
+func (s subFS) Remove(name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return s.fsys.Remove(s.join(name))
+}
+
+func (s subFS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return s.fsys.MkdirAll(s.join(name), perm)
+}
@@ -0,0 +1,149 @@
+package tfhcl
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemFS(t *testing.T) {
+	m := NewMemFS(map[string][]byte{
+		"main.tf":          []byte("# main\n"),
+		"modules/a/var.tf": []byte("# var\n"),
+	})
+
+	err := fstest.TestFS(m, "main.tf", "modules/a/var.tf")
+	assert.Equal(t, nil, err, nil)
+
+	err = m.MkdirAll(".kbst/journal", 0755)
+	assert.Equal(t, nil, err, nil)
+
+	err = m.WriteFile(".kbst/journal/1.json", []byte("{}"), 0600)
+	assert.Equal(t, nil, err, nil)
+
+	fi, err := m.Stat(".kbst/journal/1.json")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, "-rw-------", fi.Mode().String(), nil)
+
+	err = m.Remove(".kbst/journal")
+	assert.EqualError(t, err, "remove .kbst/journal: directory not empty", nil)
+
+	err = m.Rename("main.tf", "renamed.tf")
+	assert.Equal(t, nil, err, nil)
+
+	assert.Equal(t, []string{".kbst/journal/1.json", "modules/a/var.tf", "renamed.tf"}, m.Files(), nil)
+}
+
+func TestRootMemFS(t *testing.T) {
+	m := NewMemFS(map[string][]byte{
+		"changed.tf": []byte("# a\n"),
+		"deleted.tf": []byte("# deleted\n"),
+	})
+
+	r := NewRootFS("/repo", m)
+	err := r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	err = r.Lock(0)
+	assert.Equal(t, nil, err, nil)
+	defer r.Unlock()
+
+	r.WriteFiles(map[string][]byte{
+		"changed.tf": []byte("# b\n"),
+		"created.tf": []byte("# created\n"),
+	})
+	r.DeleteFiles([]string{"/repo/deleted.tf"})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []string{"/repo/changed.tf", "/repo/created.tf", "/repo/deleted.tf"}, r.WrittenFiles(), nil)
+
+	e, err := r.RecordJournal("test change")
+	assert.Equal(t, nil, err, nil)
+
+	// no temporary files or backups are left behind
+	assert.Equal(t, []string{
+		".kbst/.gitignore",
+		".kbst/journal/" + e.ID + ".json",
+		"changed.tf",
+		"created.tf",
+	}, m.Files(), nil)
+
+	d, _ := m.ReadFile("changed.tf")
+	assert.Equal(t, "# b\n", string(d), nil)
+
+	entries, err := r.Journal()
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, entries, 1, nil)
+
+	err = r.Undo(entries[0], false)
+	assert.Equal(t, nil, err, nil)
+
+	assert.Equal(t, []string{".kbst/.gitignore", "changed.tf", "deleted.tf"}, m.Files(), nil)
+}
+
+func TestRootReadOnlyFS(t *testing.T) {
+	r := NewRootFS("/repo", ReadOnlyFS(fstest.MapFS{
+		"main.tf": {Data: []byte("# main\n")},
+	}))
+	err := r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	r.WriteFiles(map[string][]byte{"main.tf": []byte("# changed\n")})
+	err = r.Write()
+	assert.ErrorIs(t, err, ErrReadOnly, nil)
+
+	// dry-runs only change the overlay
+	r.DryRun = true
+	r.WriteFiles(map[string][]byte{"main.tf": []byte("# changed\n")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	changes, err := r.Changes()
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, changes, 1, nil)
+	assert.Equal(t, "# main\n", string(changes[0].From), nil)
+	assert.Equal(t, "# changed\n", string(changes[0].To), nil)
+}
+
+func TestRootBatch(t *testing.T) {
+	m := NewMemFS(map[string][]byte{
+		"main.tf": []byte("# main\n"),
+	})
+
+	r := NewRootFS("/repo", m)
+	err := r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	r.Begin()
+	r.WriteFiles(map[string][]byte{"a.tf": []byte("# a\n")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	r.WriteFiles(map[string][]byte{"b.tf": []byte("# b\n")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	// nothing is written before Commit
+	assert.Equal(t, []string{"main.tf"}, m.Files(), nil)
+	assert.Len(t, r.Parser.Files(), 3, nil)
+
+	err = r.Rollback()
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []string{"main.tf"}, m.Files(), nil)
+	assert.Len(t, r.Parser.Files(), 1, nil)
+
+	r.Begin()
+	r.WriteFiles(map[string][]byte{"a.tf": []byte("# a\n")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	r.DeleteFiles([]string{"/repo/main.tf"})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	err = r.Commit()
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []string{"a.tf"}, m.Files(), nil)
+	assert.Equal(t, []string{"/repo/a.tf", "/repo/main.tf"}, r.WrittenFiles(), nil)
+}
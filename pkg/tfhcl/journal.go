@@ -0,0 +1,217 @@
+package tfhcl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JournalPath is the directory, relative to the root,
+// mutations are recorded in to be able to undo them
+const JournalPath = ".kbst/journal"
+
+// JournalEntry records the file contents before
+// and after a mutation
+type JournalEntry struct {
+	ID      string        `json:"id"`
+	Time    time.Time     `json:"time"`
+	Message string        `json:"message"`
+	Files   []JournalFile `json:"files"`
+}
+
+// JournalFile holds the content of a file before and after
+// a mutation, Before is nil for created, After for deleted files
+type JournalFile struct {
+	Path   string  `json:"path"`
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+func (jf JournalFile) Action() string {
+	switch {
+	case jf.Before == nil:
+		return "created"
+	case jf.After == nil:
+		return "deleted"
+	default:
+		return "changed"
+	}
+}
+
+// journalChange merges the change of path into the pending
+// journal, keeping the earliest before and latest after
+func (r *Root) journalChange(path string, before, after *string) {
+	for i, jf := range r.journal {
+		if jf.Path == path {
+			r.journal[i].After = after
+			return
+		}
+	}
+
+	r.journal = append(r.journal, JournalFile{
+		Path:   path,
+		Before: before,
+		After:  after,
+	})
+}
+
+// RecordJournal writes all changes made by Write since the
+// root was created as one journal entry, dry-runs are not
+// recorded and entries without changes are not written
+func (r *Root) RecordJournal(msg string) (e JournalEntry, err error) {
+	if r.DryRun {
+		return e, nil
+	}
+
+	now := time.Now().UTC()
+	e = JournalEntry{
+		ID:      now.Format("20060102T150405.000000000"),
+		Time:    now,
+		Message: msg,
+	}
+
+	for _, jf := range r.journal {
+		if jf.Before != nil && jf.After != nil && *jf.Before == *jf.After {
+			continue
+		}
+
+		rel, err := filepath.Rel(r.Path, jf.Path)
+		if err != nil {
+			return e, err
+		}
+		jf.Path = filepath.ToSlash(rel)
+
+		e.Files = append(e.Files, jf)
+	}
+
+	if len(e.Files) == 0 {
+		return e, nil
+	}
+
+	sort.Slice(e.Files, func(i, j int) bool {
+		return e.Files[i].Path < e.Files[j].Path
+	})
+
+	err = ensureStateDir(r.fsys)
+	if err != nil {
+		return e, err
+	}
+
+	err = r.fsys.MkdirAll(JournalPath, 0755)
+	if err != nil {
+		return e, err
+	}
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return e, err
+	}
+
+	err = r.fsys.WriteFile(path.Join(JournalPath, fmt.Sprintf("%s.json", e.ID)), data, 0644)
+	if err != nil {
+		return e, err
+	}
+
+	r.journal = nil
+
+	return e, nil
+}
+
+// Journal returns the journal entries of the root,
+// the most recent entry first
+func (r *Root) Journal() (entries []JournalEntry, err error) {
+	files, err := r.fsys.ReadDir(JournalPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return entries, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		data, err := r.fsys.ReadFile(path.Join(JournalPath, f.Name()))
+		if err != nil {
+			return entries, err
+		}
+
+		e := JournalEntry{}
+		err = json.Unmarshal(data, &e)
+		if err != nil {
+			return entries, fmt.Errorf("invalid journal entry %q: %s", f.Name(), err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID > entries[j].ID
+	})
+
+	return entries, nil
+}
+
+// Undo restores the files of e to their content before e
+// and removes e from the journal, unless force is true it
+// refuses to overwrite files changed since e was recorded
+func (r *Root) Undo(e JournalEntry, force bool) error {
+	toWrite := map[string][]byte{}
+	toDelete := []string{}
+
+	for _, jf := range e.Files {
+		fp := filepath.Join(r.Path, filepath.FromSlash(jf.Path))
+
+		if !force {
+			data, ok, err := r.current(fp)
+			if err != nil {
+				return err
+			}
+
+			if ok != (jf.After != nil) || (ok && string(data) != *jf.After) {
+				return fmt.Errorf("refusing to undo %q, %q changed since, use --force to undo anyway", e.ID, jf.Path)
+			}
+		}
+
+		if jf.Before == nil {
+			if _, ok, _ := r.current(fp); ok {
+				toDelete = append(toDelete, fp)
+			}
+			continue
+		}
+
+		toWrite[jf.Path] = []byte(*jf.Before)
+	}
+
+	err := r.WriteFiles(toWrite)
+	if err != nil {
+		return err
+	}
+
+	err = r.DeleteFiles(toDelete)
+	if err != nil {
+		return err
+	}
+
+	err = r.Write()
+	if err != nil {
+		return err
+	}
+
+	if r.DryRun {
+		return nil
+	}
+
+	// the undo itself is not journaled
+	r.journal = nil
+
+	return r.fsys.Remove(path.Join(JournalPath, fmt.Sprintf("%s.json", e.ID)))
+}
@@ -0,0 +1,109 @@
+package tfhcl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalUndo(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	os.WriteFile(filepath.Join(p, "changed.tf"), []byte("# a\n"), 0644)
+	os.WriteFile(filepath.Join(p, "deleted.tf"), []byte("# deleted\n"), 0644)
+
+	r := NewRoot(p)
+	err = r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	r.WriteFiles(map[string][]byte{"changed.tf": []byte("# b\n")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	// multiple writes are recorded as one entry
+	r.WriteFiles(map[string][]byte{
+		"changed.tf": []byte("# c\n"),
+		"created.tf": []byte("# created\n"),
+	})
+	r.DeleteFiles([]string{filepath.Join(p, "deleted.tf")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	e, err := r.RecordJournal("test change")
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, e.Files, 3, nil)
+
+	assert.FileExists(t, filepath.Join(p, ".kbst", ".gitignore"), nil)
+
+	entries, err := r.Journal()
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, entries, 1, nil)
+	assert.Equal(t, "test change", entries[0].Message, nil)
+
+	actions := map[string]string{}
+	for _, f := range entries[0].Files {
+		actions[f.Path] = f.Action()
+	}
+	assert.Equal(t, map[string]string{
+		"changed.tf": "changed",
+		"created.tf": "created",
+		"deleted.tf": "deleted",
+	}, actions, nil)
+
+	err = r.Undo(entries[0], false)
+	assert.Equal(t, nil, err, nil)
+
+	d, _ := os.ReadFile(filepath.Join(p, "changed.tf"))
+	assert.Equal(t, "# a\n", string(d), nil)
+	d, _ = os.ReadFile(filepath.Join(p, "deleted.tf"))
+	assert.Equal(t, "# deleted\n", string(d), nil)
+	assert.NoFileExists(t, filepath.Join(p, "created.tf"), nil)
+
+	entries, err = r.Journal()
+	assert.Equal(t, nil, err, nil)
+	assert.Len(t, entries, 0, nil)
+}
+
+func TestJournalUndoChangedSince(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	r := NewRoot(p)
+	r.WriteFiles(map[string][]byte{"created.tf": []byte("# created\n")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	e, err := r.RecordJournal("test change")
+	assert.Equal(t, nil, err, nil)
+
+	os.WriteFile(filepath.Join(p, "created.tf"), []byte("# local edit\n"), 0644)
+
+	err = r.Undo(e, false)
+	assert.EqualError(t, err, "refusing to undo \""+e.ID+"\", \"created.tf\" changed since, use --force to undo anyway", nil)
+	assert.FileExists(t, filepath.Join(p, "created.tf"), nil)
+
+	err = r.Undo(e, true)
+	assert.Equal(t, nil, err, nil)
+	assert.NoFileExists(t, filepath.Join(p, "created.tf"), nil)
+}
+
+func TestJournalDryRun(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	r := NewRoot(p)
+	r.DryRun = true
+	r.WriteFiles(map[string][]byte{"created.tf": []byte("# created\n")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	_, err = r.RecordJournal("test change")
+	assert.Equal(t, nil, err, nil)
+	assert.NoDirExists(t, filepath.Join(p, JournalPath), nil)
+}
@@ -0,0 +1,144 @@
+package tfhcl
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
+)
+
+// variableBlocks decodes only the variable blocks of a file
+type variableBlocks struct {
+	Variables []Variable `hcl:"variable,block"`
+	Remain    hcl.Body   `hcl:",remain"`
+}
+
+// localBlocks decodes only the locals blocks of a file
+type localBlocks struct {
+	Locals []Locals `hcl:"locals,block"`
+	Remain hcl.Body `hcl:",remain"`
+}
+
+// updateEvalContext makes variables and locals available
+// to expressions as var.<name> and local.<name>, variables
+// without a default or value are unknown
+func (r *Root) updateEvalContext() {
+	vars := map[string]cty.Value{}
+	for k, v := range r.variables {
+		if v == cty.NilVal {
+			v = cty.DynamicVal
+		}
+		vars[k] = v
+	}
+
+	r.evalContext.Variables["var"] = cty.ObjectVal(vars)
+	r.evalContext.Variables["local"] = cty.ObjectVal(r.locals)
+}
+
+// decodeLocals evaluates the locals of the configuration files
+// in names in dependency order, locals that can not be evaluated,
+// e.g. because they reference resources or module outputs, or
+// that are part of a cycle are unknown, locals defined more
+// than once are an error, like in Terraform
+func (r *Root) decodeLocals(names []string) (diags hcl.Diagnostics) {
+	files := r.Parser.Files()
+
+	exprs := map[string]hcl.Expression{}
+	defs := map[string]hcl.Range{}
+	for _, k := range names {
+		if !isConfigFile(k) {
+			continue
+		}
+
+		lb := localBlocks{}
+		moreDiags := gohcl.DecodeBody(files[k].Body, nil, &lb)
+		diags = append(diags, moreDiags...)
+
+		for _, l := range lb.Locals {
+			attrs, moreDiags := l.Body.JustAttributes()
+			diags = append(diags, moreDiags...)
+
+			for _, a := range sortedAttributes(attrs) {
+				if prev, ok := defs[a.Name]; ok {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Duplicate local value definition",
+						Detail:   fmt.Sprintf("A local value named %q was already defined at %s. Local value names must be unique within a module.", a.Name, prev),
+						Subject:  a.NameRange.Ptr(),
+					})
+					continue
+				}
+
+				defs[a.Name] = a.NameRange
+				exprs[a.Name] = a.Expr
+			}
+		}
+	}
+
+	for len(exprs) > 0 {
+		pending := maps.Keys(exprs)
+		sort.Strings(pending)
+
+		evaluated := false
+		for _, n := range pending {
+			if dependsOnLocals(exprs[n], exprs, n) {
+				continue
+			}
+
+			v, moreDiags := exprs[n].Value(r.evalContext)
+			if moreDiags.HasErrors() {
+				v = cty.DynamicVal
+			}
+
+			r.locals[n] = v
+			r.evalContext.Variables["local"] = cty.ObjectVal(r.locals)
+			delete(exprs, n)
+			evaluated = true
+		}
+
+		if !evaluated {
+			for n := range exprs {
+				r.locals[n] = cty.DynamicVal
+			}
+			break
+		}
+	}
+	r.updateEvalContext()
+
+	return diags
+}
+
+// sortedAttributes returns attrs in the order they
+// are defined in, for deterministic diagnostics
+func sortedAttributes(attrs hcl.Attributes) []*hcl.Attribute {
+	sorted := maps.Values(attrs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Range.Start.Byte < sorted[j].Range.Start.Byte
+	})
+
+	return sorted
+}
+
+// dependsOnLocals returns true if expr references any
+// local in pending, other than the local self
+func dependsOnLocals(expr hcl.Expression, pending map[string]hcl.Expression, self string) bool {
+	for _, t := range expr.Variables() {
+		if t.RootName() != "local" || len(t) < 2 {
+			continue
+		}
+
+		ta, ok := t[1].(hcl.TraverseAttr)
+		if !ok || ta.Name == self {
+			continue
+		}
+
+		if _, ok := pending[ta.Name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
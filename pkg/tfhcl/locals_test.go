@@ -0,0 +1,122 @@
+package tfhcl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestReadLocalsAndFunctions(t *testing.T) {
+	r := NewRootFS("/repo", NewMemFS(map[string][]byte{
+		"variables.tf": []byte(`
+variable "env" {
+  default = "apps"
+}
+
+variable "zones" {}
+`),
+		"config.auto.tfvars": []byte(`zones = ["eu-west-1a", "eu-west-1b"]`),
+		"locals.tf": []byte(`
+locals {
+  name   = format("%s-%s", local.prefix, var.env)
+  prefix = "kbst"
+  tags   = merge(local.base, { team = "platform" })
+  base   = { owner = "ops" }
+
+  kubeconfig = yamldecode(module.test_service.kubeconfig)
+
+  cycle_a = local.cycle_b
+  cycle_b = local.cycle_a
+}
+`),
+		"service.tf": []byte(`
+module "test_service" {
+  source  = "kbst.xyz/catalog/test/kustomization"
+  version = "0.0.0-test.0"
+
+  configuration = {
+    apps = {
+      name       = local.name
+      zones      = join(",", var.zones)
+      owner      = lookup(local.tags, "owner", "nobody")
+      domain     = replace("apps.example.com", "/^apps\\./", "")
+      kubeconfig = local.kubeconfig
+    }
+  }
+}
+`),
+	}))
+
+	err := r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	v, ok := r.GetLocalValue("tags")
+	assert.True(t, ok, nil)
+	assert.Equal(t, cty.ObjectVal(map[string]cty.Value{
+		"owner": cty.StringVal("ops"),
+		"team":  cty.StringVal("platform"),
+	}), v, nil)
+
+	// locals referencing modules or cycles are unknown
+	for _, n := range []string{"kubeconfig", "cycle_a", "cycle_b"} {
+		v, ok := r.GetLocalValue(n)
+		assert.True(t, ok, n)
+		assert.False(t, v.IsKnown(), n)
+	}
+
+	mods := r.Modules["/repo/service.tf"]
+	assert.Len(t, mods, 1, nil)
+	assert.Equal(t, map[string]cty.Value{
+		"name":   cty.StringVal("kbst-apps"),
+		"zones":  cty.StringVal("eu-west-1a,eu-west-1b"),
+		"owner":  cty.StringVal("ops"),
+		"domain": cty.StringVal("example.com"),
+	}, mods[0].Configuration["apps"], nil)
+}
+
+func TestReadLocalsCycle(t *testing.T) {
+	r := NewRootFS("/repo", NewMemFS(map[string][]byte{
+		"locals.tf": []byte(`
+locals {
+  a = "${local.c}-a"
+  b = "${local.a}-b"
+  c = "${local.b}-c"
+
+  uses_cycle = local.a
+  known      = "known"
+}
+`),
+	}))
+
+	err := r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	// all locals of the cycle and those using them are unknown
+	for _, n := range []string{"a", "b", "c", "uses_cycle"} {
+		v, ok := r.GetLocalValue(n)
+		assert.True(t, ok, n)
+		assert.False(t, v.IsKnown(), n)
+	}
+
+	v, _ := r.GetLocalValue("known")
+	assert.Equal(t, cty.StringVal("known"), v, nil)
+}
+
+func TestReadLocalsDuplicate(t *testing.T) {
+	r := NewRootFS("/repo", NewMemFS(map[string][]byte{
+		"a.tf": []byte(`
+locals {
+  name = "a"
+}
+`),
+		"b.tf": []byte(`
+locals {
+  name = "b"
+}
+`),
+	}))
+
+	err := r.Read()
+	assert.EqualError(t, err, `/repo/b.tf:3,3-7: Duplicate local value definition; A local value named "name" was already defined at /repo/a.tf:3,3-7. Local value names must be unique within a module.`, nil)
+}
@@ -0,0 +1,264 @@
+package tfhcl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// LockPath is the lock file, relative to the root
+const LockPath = ".kbst/lock"
+
+// staleLockAge is the age after which a lock is
+// considered stale, even if its process can not be checked
+const staleLockAge = time.Hour
+
+const lockRetryInterval = 100 * time.Millisecond
+
+var ErrLocked = errors.New("repository is locked")
+
+// breakSuffix is appended to the lock path for the file
+// serializing processes breaking a stale lock
+const breakSuffix = ".break"
+
+// errBreaking is returned by breakLock if
+// another process is breaking the lock
+var errBreaking = errors.New("stale lock is being broken")
+
+// beforeBreakLock is called before a stale lock is broken,
+// tests use it to make waiters race for the stale lock
+var beforeBreakLock func()
+
+type lockInfo struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Time     time.Time `json:"time"`
+}
+
+// stale returns true if the process holding the lock
+// is gone, or if the lock is older than staleLockAge
+func (li lockInfo) stale(now time.Time) bool {
+	if now.Sub(li.Time) > staleLockAge {
+		return true
+	}
+
+	hn, _ := os.Hostname()
+	if li.Hostname == hn && !processAlive(li.PID) {
+		return true
+	}
+
+	return false
+}
+
+// Lock acquires an advisory lock on the root against other
+// kbst processes, waiting up to timeout for it to be released,
+// stale locks are broken, dry-runs and roots not on disk do not lock
+func (r *Root) Lock(timeout time.Duration) error {
+	if r.DryRun || r.locked {
+		return nil
+	}
+
+	if _, ok := r.fsys.(dirFS); !ok {
+		return nil
+	}
+
+	err := ensureStateDir(r.fsys)
+	if err != nil {
+		return err
+	}
+
+	lp := filepath.Join(r.Path, LockPath)
+	deadline := time.Now().Add(timeout)
+
+	for {
+		err = createLock(lp)
+		if err == nil {
+			r.locked = true
+			return nil
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+
+		li, err := readLock(lp)
+		if os.IsNotExist(err) {
+			// released in the meantime
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if li.stale(time.Now()) {
+			err = breakLock(lp, li)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, errBreaking) {
+				return err
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w by pid %d on %q since %s, gave up after %s, remove %q if no other kbst process is running", ErrLocked, li.PID, li.Hostname, li.Time.Local().Format(time.RFC3339), timeout, lp)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Unlock releases the lock acquired by Lock
+func (r *Root) Unlock() error {
+	if !r.locked {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(r.Path, LockPath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	r.locked = false
+
+	return nil
+}
+
+// breakLock removes the stale lock li at lp, one process at a
+// time, it re-reads the lock and renames it to a unique name
+// before removing it, and puts it back if it is not li, so a
+// waiter never removes a lock another waiter took in the meantime
+func breakLock(lp string, li lockInfo) error {
+	if beforeBreakLock != nil {
+		beforeBreakLock()
+	}
+
+	bp := lp + breakSuffix
+	err := createLock(bp)
+	if os.IsExist(err) {
+		// another process is breaking the lock, a break
+		// lock left behind by a dead process is removed
+		bi, err := readLock(bp)
+		if err == nil && bi.stale(time.Now()) {
+			os.Remove(bp)
+		}
+
+		return errBreaking
+	}
+	if err != nil {
+		return err
+	}
+	defer os.Remove(bp)
+
+	cur, err := readLock(lp)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !cur.same(li) {
+		// broken and taken by another waiter
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(lp), filepath.Base(lp)+".stale-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	err = os.Rename(lp, tmp.Name())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cur, err = readLock(tmp.Name())
+	if err != nil {
+		return err
+	}
+
+	if !cur.same(li) {
+		// released and taken again since it was
+		// read, put it back unless there is a new one
+		err = os.Link(tmp.Name(), lp)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// same returns true if li and o describe the same lock
+func (li lockInfo) same(o lockInfo) bool {
+	return li.PID == o.PID && li.Hostname == o.Hostname && li.Time.Equal(o.Time)
+}
+
+func createLock(lp string) error {
+	f, err := os.OpenFile(lp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	hn, _ := os.Hostname()
+	err = json.NewEncoder(f).Encode(lockInfo{
+		PID:      os.Getpid(),
+		Hostname: hn,
+		Time:     time.Now().UTC(),
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(lp)
+		return err
+	}
+
+	return nil
+}
+
+func readLock(lp string) (li lockInfo, err error) {
+	data, err := os.ReadFile(lp)
+	if err != nil {
+		return li, err
+	}
+
+	err = json.Unmarshal(data, &li)
+	if err != nil {
+		// a lock being written right now, or a broken one,
+		// fall back to the file's age to detect staleness
+		fi, serr := os.Stat(lp)
+		if serr != nil {
+			return li, serr
+		}
+		li = lockInfo{Time: fi.ModTime()}
+	}
+
+	return li, nil
+}
+
+// ensureStateDir creates the directory holding kbst's
+// local state, ignored by git, if it does not exist
+func ensureStateDir(fsys FS) error {
+	sp := path.Dir(LockPath)
+	err := fsys.MkdirAll(sp, 0755)
+	if err != nil {
+		return err
+	}
+
+	gi := path.Join(sp, ".gitignore")
+	if _, err := fsys.Stat(gi); errors.Is(err, fs.ErrNotExist) {
+		return fsys.WriteFile(gi, []byte("*\n"), 0644)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package tfhcl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	r1 := NewRoot(p)
+	err = r1.Lock(time.Second)
+	assert.Equal(t, nil, err, nil)
+	assert.FileExists(t, filepath.Join(p, LockPath), nil)
+
+	r2 := NewRoot(p)
+	err = r2.Lock(200 * time.Millisecond)
+	assert.ErrorIs(t, err, ErrLocked, nil)
+
+	err = r1.Unlock()
+	assert.Equal(t, nil, err, nil)
+	assert.NoFileExists(t, filepath.Join(p, LockPath), nil)
+
+	err = r2.Lock(time.Second)
+	assert.Equal(t, nil, err, nil)
+
+	err = r2.Unlock()
+	assert.Equal(t, nil, err, nil)
+}
+
+func TestLockWaits(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	r1 := NewRoot(p)
+	err = r1.Lock(time.Second)
+	assert.Equal(t, nil, err, nil)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		r1.Unlock()
+	}()
+
+	r2 := NewRoot(p)
+	err = r2.Lock(5 * time.Second)
+	assert.Equal(t, nil, err, nil)
+
+	r2.Unlock()
+}
+
+func TestLockStale(t *testing.T) {
+	hn, _ := os.Hostname()
+
+	cases := map[string]lockInfo{
+		// above the maximum pid on linux, no process has it
+		"dead process": {PID: 4194305, Hostname: hn, Time: time.Now().UTC()},
+		"old lock":     {PID: os.Getpid(), Hostname: "other-host", Time: time.Now().Add(-2 * staleLockAge)},
+	}
+
+	for name, li := range cases {
+		p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+		assert.Equal(t, nil, err, name)
+		defer os.RemoveAll(p)
+
+		err = ensureStateDir(DirFS(p))
+		assert.Equal(t, nil, err, name)
+
+		data, _ := json.Marshal(li)
+		os.WriteFile(filepath.Join(p, LockPath), data, 0644)
+
+		r := NewRoot(p)
+		err = r.Lock(200 * time.Millisecond)
+		assert.Equal(t, nil, err, name)
+
+		r.Unlock()
+	}
+}
+
+func TestLockStaleConcurrent(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	err = ensureStateDir(DirFS(p))
+	assert.Equal(t, nil, err, nil)
+
+	data, _ := json.Marshal(lockInfo{PID: os.Getpid(), Hostname: "other-host", Time: time.Now().Add(-2 * staleLockAge)})
+	os.WriteFile(filepath.Join(p, LockPath), data, 0644)
+
+	// all waiters see the stale lock before any
+	// of them breaks it, only one may hold the lock
+	const waiters = 20
+	var seen sync.WaitGroup
+	var calls int32
+	seen.Add(waiters)
+	beforeBreakLock = func() {
+		if atomic.AddInt32(&calls, 1) <= waiters {
+			seen.Done()
+			seen.Wait()
+		}
+	}
+	defer func() { beforeBreakLock = nil }()
+
+	var holders, maxHolders int32
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r := NewRoot(p)
+			err := r.Lock(30 * time.Second)
+			assert.Equal(t, nil, err, nil)
+			if err != nil {
+				return
+			}
+
+			h := atomic.AddInt32(&holders, 1)
+			for {
+				m := atomic.LoadInt32(&maxHolders)
+				if h <= m || atomic.CompareAndSwapInt32(&maxHolders, m, h) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+
+			err = r.Unlock()
+			assert.Equal(t, nil, err, nil)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), maxHolders, nil)
+
+	// no renamed locks are left behind
+	entries, _ := os.ReadDir(filepath.Join(p, filepath.Dir(LockPath)))
+	for _, e := range entries {
+		assert.Equal(t, ".gitignore", e.Name(), nil)
+	}
+}
+
+func TestLockDryRun(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	r := NewRoot(p)
+	r.DryRun = true
+	err = r.Lock(time.Second)
+	assert.Equal(t, nil, err, nil)
+	assert.NoDirExists(t, filepath.Join(p, ".kbst"), nil)
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package tfhcl
+
+import "os"
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+
+	return true
+}
@@ -2,9 +2,12 @@ package tfhcl
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"golang.org/x/exp/maps"
@@ -18,18 +21,70 @@ import (
 
 type Root struct {
 	Path        string
+	fsys        FS
 	Parser      *hclparse.Parser
 	evalContext *hcl.EvalContext
+	variables   map[string]cty.Value
+	locals      map[string]cty.Value
 	Variables   map[string][]Variable
 	Modules     map[string][]Module
 	Providers   map[string][]Provider
 	toWrite     map[string][]byte
 	toDelete    []string
+
+	// Dirs are additional directories, relative to Path, whose
+	// configuration and variable files are read as part of the
+	// root, entries may be glob patterns as for path.Match
+	Dirs []string
+
+	// Children holds the roots of the modules with a
+	// local source, by module name, see readChildren
+	Children map[string]*Root
+
+	// parent is the root of the module calling this root
+	parent *Root
+
+	// DryRun keeps all writes and deletes in memory,
+	// use Changes to get the result
+	DryRun  bool
+	overlay map[string]overlayFile
+
+	// batch keeps writes in the overlay until Commit,
+	// batchBase is the overlay when Begin was called
+	batch     bool
+	batchBase map[string]overlayFile
+
+	// written holds all paths changed on disk
+	written []string
+
+	// journal holds all changes not yet recorded
+	journal []JournalFile
+
+	// locked is true while the root holds its lock
+	locked bool
+
+	// BeforeWrite, if set, is called with the paths Write
+	// is about to change on disk, excluding paths Write
+	// changed earlier, returning an error aborts the write
+	BeforeWrite func(paths []string) error
+}
+
+type overlayFile struct {
+	data    []byte
+	deleted bool
 }
 
 func NewRoot(path string) *Root {
+	return NewRootFS(path, DirFS(path))
+}
+
+// NewRootFS returns a root reading from and writing to fsys,
+// paths of the root's files are still joined to path
+func NewRootFS(path string, fsys FS) *Root {
 	r := Root{
-		Path: path,
+		Path:    path,
+		fsys:    fsys,
+		overlay: make(map[string]overlayFile),
 	}
 
 	r.clear()
@@ -42,99 +97,250 @@ func (r *Root) clear() {
 
 	r.evalContext = &hcl.EvalContext{
 		Variables: map[string]cty.Value{},
-		Functions: nil,
+		Functions: functions(),
 	}
+	r.variables = make(map[string]cty.Value)
+	r.locals = make(map[string]cty.Value)
+	r.updateEvalContext()
 	r.Variables = make(map[string][]Variable)
 	r.Modules = make(map[string][]Module)
 	r.Providers = make(map[string][]Provider)
-	r.toWrite = make(map[string][]byte)
-	r.toDelete = make([]string, 0)
+	r.Children = make(map[string]*Root)
+	r.clearPending()
 }
 
 func (r *Root) Read() (err error) {
 	// if we re-read, clear the data
 	r.clear()
 
-	files, err := os.ReadDir(r.Path)
+	diags, err := r.readDir(".", true)
 	if err != nil {
 		return err
 	}
 
-	diags := hcl.Diagnostics{}
+	dirs, err := r.dirs()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dirs {
+		moreDiags, err := r.readDir(d, false)
+		if err != nil {
+			return err
+		}
+		diags.Extend(moreDiags)
+	}
+
+	paths := maps.Keys(r.overlay)
+	sort.Strings(paths)
+	for _, fp := range paths {
+		o := r.overlay[fp]
+		if o.deleted {
+			continue
+		}
+
+		diags.Extend(r.parse(o.data, fp))
+	}
+
+	err = r.decode()
+	if err != nil {
+		return err
+	}
+
+	return r.readChildren()
+}
+
+// readDir parses the files in dir, all files if all is true,
+// otherwise only configuration and variable files
+func (r *Root) readDir(dir string, all bool) (diags hcl.Diagnostics, err error) {
+	files, err := r.fsys.ReadDir(dir)
+	if err != nil {
+		return diags, err
+	}
 
 	for _, f := range files {
 		if f.IsDir() {
 			continue
 		}
 
-		fp := filepath.Join(r.Path, f.Name())
-		_, diag := r.Parser.ParseHCLFile(fp)
-		diags.Extend(diag)
+		if !all && !isConfigFile(f.Name()) && !isVariablesFile(f.Name()) {
+			continue
+		}
+
+		name := path.Join(dir, f.Name())
+		fp := filepath.Join(r.Path, filepath.FromSlash(name))
+		if _, ok := r.overlay[fp]; ok {
+			continue
+		}
+
+		data, err := r.fsys.ReadFile(name)
+		if err != nil {
+			return diags, err
+		}
+
+		diags.Extend(r.parse(data, fp))
+	}
+
+	return diags, nil
+}
+
+// dirs returns the directories matching Dirs, sorted,
+// patterns without any match are an error
+func (r *Root) dirs() (dirs []string, err error) {
+	for _, pattern := range r.Dirs {
+		matches, err := fs.Glob(r.fsys, path.Clean(pattern))
+		if err != nil {
+			return dirs, err
+		}
+
+		found := false
+		for _, m := range matches {
+			fi, err := r.fsys.Stat(m)
+			if err != nil || !fi.IsDir() || m == "." {
+				continue
+			}
+
+			// like shells, only match hidden directories
+			// if the pattern starts with a dot
+			if strings.HasPrefix(path.Base(m), ".") && !strings.HasPrefix(path.Base(pattern), ".") {
+				continue
+			}
+
+			found = true
+			if !slices.Contains(dirs, m) {
+				dirs = append(dirs, m)
+			}
+		}
+
+		if !found {
+			return dirs, fmt.Errorf("no directory matches %q", pattern)
+		}
 	}
 
-	return r.decode()
+	sort.Strings(dirs)
+
+	return dirs, nil
+}
+
+// parse parses data as JSON or native syntax, depending
+// on the file extension of fp
+func (r *Root) parse(data []byte, fp string) hcl.Diagnostics {
+	if IsJSONFile(fp) {
+		_, diags := r.Parser.ParseJSON(data, fp)
+		return diags
+	}
+
+	_, diags := r.Parser.ParseHCL(data, fp)
+	return diags
+}
+
+// IsJSONFile returns true if the file at fp
+// is written in the JSON syntax
+func IsJSONFile(fp string) bool {
+	return strings.HasSuffix(fp, ".json")
+}
+
+// isConfigFile returns true for Terraform configuration
+// files, in native or JSON syntax
+func isConfigFile(fp string) bool {
+	return strings.HasSuffix(fp, ".tf") || strings.HasSuffix(fp, ".tf.json")
+}
+
+// isVariablesFile returns true for the variable
+// definition files Terraform loads automatically
+func isVariablesFile(fp string) bool {
+	n := strings.TrimSuffix(filepath.Base(fp), ".json")
+
+	return n == "terraform.tfvars" || strings.HasSuffix(n, ".auto.tfvars")
 }
 
 func (r *Root) decode() (err error) {
 	diags := hcl.Diagnostics{}
 
-	// variable definitions, defaults and providers
-	for k, v := range r.Parser.Files() {
-		if !strings.HasSuffix(k, ".tf") {
+	files := r.Parser.Files()
+	names := maps.Keys(files)
+	sort.Strings(names)
+
+	// variable definitions and defaults
+	for _, k := range names {
+		if !isConfigFile(k) {
 			continue
 		}
 
-		kb := Blocks{}
-		moreDiags := gohcl.DecodeBody(v.Body, r.evalContext, &kb)
+		vb := variableBlocks{}
+		moreDiags := gohcl.DecodeBody(files[k].Body, r.evalContext, &vb)
 		diags = append(diags, moreDiags...)
 
 		if !slices.Contains(maps.Keys(r.Variables), k) {
 			r.Variables[k] = []Variable{}
 		}
 
-		for _, vd := range kb.Variables {
+		for _, vd := range vb.Variables {
 			r.Variables[k] = append(r.Variables[k], vd)
-			r.evalContext.Variables[vd.Name] = vd.Default
+			r.variables[vd.Name] = vd.Default
 		}
-
-		if !slices.Contains(maps.Keys(r.Providers), k) {
-			r.Providers[k] = []Provider{}
-		}
-		r.Providers[k] = append(r.Providers[k], kb.Providers...)
 	}
 
 	// variable values from tfvar files
-	for k, v := range r.Parser.Files() {
-		if k != "terraform.tfvars" && !strings.HasSuffix(k, ".auto.tfvars") {
+	for _, k := range names {
+		if !isVariablesFile(k) {
 			continue
 		}
 
 		vv := make(map[string]cty.Value)
-		moreDiags := gohcl.DecodeBody(v.Body, r.evalContext, &vv)
+		moreDiags := gohcl.DecodeBody(files[k].Body, r.evalContext, &vv)
 		diags = append(diags, moreDiags...)
 
 		for ik, iv := range vv {
-			r.evalContext.Variables[ik] = iv
+			r.variables[ik] = iv
 		}
 	}
+	r.updateEvalContext()
+
+	diags = append(diags, r.decodeLocals(names)...)
 
-	// parse, now that we know the evalContext
-	for k, v := range r.Parser.Files() {
-		if !strings.HasSuffix(k, ".tf") {
+	// providers, now that we know the evalContext
+	blocks := map[string]Blocks{}
+	for _, k := range names {
+		if !isConfigFile(k) {
 			continue
 		}
 
 		kb := Blocks{}
-		moreDiags := gohcl.DecodeBody(v.Body, r.evalContext, &kb)
+		moreDiags := gohcl.DecodeBody(files[k].Body, r.evalContext, &kb)
 		diags = append(diags, moreDiags...)
+		blocks[k] = kb
+
+		if !slices.Contains(maps.Keys(r.Providers), k) {
+			r.Providers[k] = []Provider{}
+		}
+		r.Providers[k] = append(r.Providers[k], kb.Providers...)
+	}
+
+	// modules, now that we know all providers
+	for _, k := range names {
+		kb, ok := blocks[k]
+		if !ok {
+			continue
+		}
 
 		for i, mod := range kb.Modules {
 			// parse raw module providers
 			mod.Providers = make(map[string]Provider)
-			for _, t := range mod.ProvidersRaw.Variables() {
-				spl := t.SimpleSplit()
-				k := spl.RootName()
-				v := spl.Rel[0].(hcl.TraverseAttr).Name
+			pairs, _ := hcl.ExprMap(mod.ProvidersRaw)
+			for _, pair := range pairs {
+				// provider references are traversals in native
+				// and strings in JSON syntax, read both the same
+				t, diags := hcl.AbsTraversalForExpr(pair.Value)
+				if diags.HasErrors() || len(t) != 2 {
+					continue
+				}
+
+				ta, ok := t[1].(hcl.TraverseAttr)
+				if !ok {
+					continue
+				}
+				k, v := t.RootName(), ta.Name
 
 				for _, pf := range r.Providers {
 					for _, p := range pf {
@@ -155,13 +361,6 @@ func (r *Root) decode() (err error) {
 					mod.Configuration[k] = make(map[string]cty.Value)
 
 					for ik, iv := range v.AsValueMap() {
-						// get the variable's value
-						if iv.Type().HasDynamicTypes() {
-							if v, ok := r.GetVariableValue(ik); ok {
-								iv = v
-							}
-						}
-
 						if iv.IsNull() || !iv.IsWhollyKnown() {
 							continue
 						}
@@ -199,6 +398,13 @@ func (r *Root) WriteFiles(data map[string][]byte) error {
 	return nil
 }
 
+// PendingFile returns the data passed to WriteFiles
+// for the file at path that Write did not write yet
+func (r *Root) PendingFile(path string) (data []byte, ok bool) {
+	data, ok = r.toWrite[path]
+	return data, ok
+}
+
 func (r *Root) DeleteFiles(paths []string) error {
 	r.toDelete = append(r.toDelete, paths...)
 
@@ -206,48 +412,263 @@ func (r *Root) DeleteFiles(paths []string) error {
 }
 
 func (r *Root) GetVariableValue(name string) (value cty.Value, ok bool) {
-	v, ok := r.evalContext.Variables[name]
+	v, ok := r.variables[name]
 	return v, ok
 }
 
 func (r *Root) SetVariableValue(name string, value cty.Value) {
-	r.evalContext.Variables[name] = value
+	r.variables[name] = value
+	r.updateEvalContext()
 }
 
+// GetLocalValue returns the value of the local name,
+// unknown if it could not be evaluated
+func (r *Root) GetLocalValue(name string) (value cty.Value, ok bool) {
+	v, ok := r.locals[name]
+	return v, ok
+}
+
+// Write applies all pending writes and deletes as one transaction,
+// if any of them fails, all earlier changes are rolled back
 func (r *Root) Write() (err error) {
-	for n, f := range r.toWrite {
+	if r.DryRun || r.batch {
+		return r.writeOverlay()
+	}
+
+	tx := &transaction{fsys: r.fsys}
 
-		var ef []byte
-		exists := false
-		mode := os.FileMode(0644)
-		if fi, err := os.Stat(n); err == nil {
-			exists = true
+	paths := maps.Keys(r.toWrite)
+	sort.Strings(paths)
+
+	for _, n := range paths {
+		f := r.toWrite[n]
+
+		if slices.Contains(r.toDelete, n) {
+			// no point writing a file
+			// if we delete it later anyway
+			continue
+		}
+
+		name, err := r.name(n)
+		if err != nil {
+			r.discard(tx)
+			return err
+		}
+
+		mode := fs.FileMode(0644)
+		if fi, err := r.fsys.Stat(name); err == nil {
 			mode = fi.Mode()
-			ef, err = os.ReadFile(n)
+			ef, err := r.fsys.ReadFile(name)
 			if err != nil {
+				r.discard(tx)
 				return err
 			}
-		}
 
-		if !exists || !bytes.Equal(ef, f) {
-			if slices.Contains(r.toDelete, n) {
-				// no point writing a file
-				// if we delete it later anyway
+			if bytes.Equal(ef, f) {
 				continue
 			}
-			err = os.WriteFile(n, f, mode)
-			if err != nil {
-				return err
+		}
+
+		err = tx.stageWrite(n, name, f, mode)
+		if err != nil {
+			r.discard(tx)
+			return err
+		}
+	}
+
+	for _, n := range r.toDelete {
+		name, err := r.name(n)
+		if err != nil {
+			r.discard(tx)
+			return err
+		}
+
+		tx.stageDelete(n, name)
+	}
+
+	if r.BeforeWrite != nil {
+		paths := []string{}
+		for _, op := range tx.ops {
+			if !slices.Contains(r.written, op.path) {
+				paths = append(paths, op.path)
 			}
 		}
+
+		err = r.BeforeWrite(paths)
+		if err != nil {
+			r.discard(tx)
+			return err
+		}
+	}
+
+	before := map[string]*string{}
+	for _, op := range tx.ops {
+		data, err := r.fsys.ReadFile(op.name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			r.discard(tx)
+			return err
+		}
+		if err == nil {
+			content := string(data)
+			before[op.path] = &content
+		}
+	}
+
+	err = tx.commit()
+	if err != nil {
+		r.discard(tx)
+		return err
+	}
+
+	for _, op := range tx.ops {
+		if !slices.Contains(r.written, op.path) {
+			r.written = append(r.written, op.path)
+		}
+
+		var after *string
+		if !slices.Contains(r.toDelete, op.path) {
+			content := string(r.toWrite[op.path])
+			after = &content
+		}
+		r.journalChange(op.path, before[op.path], after)
+	}
+
+	return r.Read()
+}
+
+// Begin starts a batch, until Commit, Write keeps all
+// changes in memory, like for a dry-run, so that a batch
+// failing partway through leaves the disk unchanged
+func (r *Root) Begin() {
+	r.batch = true
+	r.batchBase = maps.Clone(r.overlay)
+}
+
+// Commit ends the batch started by Begin and writes
+// all its changes to disk at once, unless DryRun is set
+func (r *Root) Commit() error {
+	if !r.batch {
+		return nil
+	}
+	r.batch = false
+
+	if r.DryRun {
+		return nil
+	}
+
+	for fp, o := range r.overlay {
+		if !o.deleted {
+			r.toWrite[fp] = o.data
+			continue
+		}
+
+		// files created and deleted again are not on disk
+		name, err := r.name(fp)
+		if err != nil {
+			return err
+		}
+		if _, err := r.fsys.Stat(name); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		r.toDelete = append(r.toDelete, fp)
+	}
+	r.overlay = make(map[string]overlayFile)
+
+	return r.Write()
+}
+
+// Rollback ends the batch started by Begin
+// and drops all changes made since
+func (r *Root) Rollback() error {
+	if !r.batch {
+		return nil
 	}
+	r.batch = false
+
+	r.overlay = r.batchBase
+	r.clearPending()
+
+	return r.Read()
+}
+
+// discard rolls back tx and drops all pending changes
+func (r *Root) discard(tx *transaction) {
+	tx.rollback()
+	r.clearPending()
+}
+
+func (r *Root) clearPending() {
+	r.toWrite = make(map[string][]byte)
+	r.toDelete = make([]string, 0)
+}
+
+// WrittenFiles returns the paths of all files
+// changed on disk by Write, sorted
+func (r *Root) WrittenFiles() []string {
+	paths := slices.Clone(r.written)
+	sort.Strings(paths)
+
+	return paths
+}
 
+// writeOverlay applies all pending writes and deletes
+// to the in-memory overlay instead of the disk
+func (r *Root) writeOverlay() error {
 	for _, n := range r.toDelete {
-		err := os.Remove(n)
+		_, ok, err := r.current(n)
+		if err == nil && !ok {
+			err = &fs.PathError{Op: "remove", Path: n, Err: fs.ErrNotExist}
+		}
 		if err != nil {
+			r.clearPending()
 			return err
 		}
 	}
 
+	for n, f := range r.toWrite {
+		if slices.Contains(r.toDelete, n) {
+			continue
+		}
+
+		r.overlay[n] = overlayFile{data: f}
+	}
+
+	for _, n := range r.toDelete {
+		r.overlay[n] = overlayFile{deleted: true}
+	}
+
 	return r.Read()
 }
+
+// current returns the content of the file at path,
+// taking pending changes in the overlay into account
+func (r *Root) current(path string) (data []byte, ok bool, err error) {
+	if o, found := r.overlay[path]; found {
+		return o.data, !o.deleted, nil
+	}
+
+	name, err := r.name(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err = r.fsys.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return data, true, nil
+}
+
+// name returns the name of the file at path in the root's FS
+func (r *Root) name(path string) (string, error) {
+	rel, err := filepath.Rel(r.Path, path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(rel), nil
+}
@@ -1,7 +1,11 @@
 package tfhcl
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -51,3 +55,175 @@ func TestReadTwoModules(t *testing.T) {
 	assert.Equal(t, "test_mod1", mods[0].Name, nil)
 	assert.Equal(t, "test_mod2", mods[1].Name, nil)
 }
+
+func TestWriteTransaction(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	err = os.WriteFile(filepath.Join(p, "existing.tf"), []byte("# existing\n"), 0600)
+	assert.Equal(t, nil, err, nil)
+
+	r := NewRoot(p)
+	err = r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	r.WriteFiles(map[string][]byte{
+		"existing.tf": []byte("# changed\n"),
+		"new.tf":      []byte("# new\n"),
+	})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	d, _ := os.ReadFile(filepath.Join(p, "existing.tf"))
+	assert.Equal(t, "# changed\n", string(d), nil)
+
+	fi, _ := os.Stat(filepath.Join(p, "existing.tf"))
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), nil)
+
+	d, _ = os.ReadFile(filepath.Join(p, "new.tf"))
+	assert.Equal(t, "# new\n", string(d), nil)
+
+	assertNoTransactionLeftovers(t, p)
+}
+
+func TestWriteTransactionRollback(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	err = os.WriteFile(filepath.Join(p, "existing.tf"), []byte("# existing\n"), 0644)
+	assert.Equal(t, nil, err, nil)
+
+	r := NewRoot(p)
+	err = r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	r.WriteFiles(map[string][]byte{
+		"existing.tf": []byte("# changed\n"),
+		"new.tf":      []byte("# new\n"),
+	})
+	r.DeleteFiles([]string{filepath.Join(p, "does-not-exist.tf")})
+
+	err = r.Write()
+	assert.ErrorIs(t, err, os.ErrNotExist, nil)
+
+	d, _ := os.ReadFile(filepath.Join(p, "existing.tf"))
+	assert.Equal(t, "# existing\n", string(d), nil)
+
+	_, err = os.Stat(filepath.Join(p, "new.tf"))
+	assert.True(t, os.IsNotExist(err), nil)
+
+	assertNoTransactionLeftovers(t, p)
+
+	// pending changes are dropped after a failed write
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	d, _ = os.ReadFile(filepath.Join(p, "existing.tf"))
+	assert.Equal(t, "# existing\n", string(d), nil)
+}
+
+func TestWriteBeforeWrite(t *testing.T) {
+	p, err := os.MkdirTemp("", "kbst-tfhcl-*")
+	assert.Equal(t, nil, err, nil)
+	defer os.RemoveAll(p)
+
+	r := NewRoot(p)
+
+	var called [][]string
+	r.BeforeWrite = func(paths []string) error {
+		called = append(called, paths)
+		if len(paths) > 1 {
+			return errors.New("refused")
+		}
+		return nil
+	}
+
+	r.WriteFiles(map[string][]byte{"a.tf": []byte("# a\n")})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	// paths written earlier are not passed again
+	r.WriteFiles(map[string][]byte{
+		"a.tf": []byte("# changed\n"),
+		"b.tf": []byte("# b\n"),
+	})
+	err = r.Write()
+	assert.Equal(t, nil, err, nil)
+
+	r.WriteFiles(map[string][]byte{
+		"c.tf": []byte("# c\n"),
+		"d.tf": []byte("# d\n"),
+	})
+	err = r.Write()
+	assert.EqualError(t, err, "refused", nil)
+
+	assert.Equal(t, [][]string{
+		{filepath.Join(p, "a.tf")},
+		{filepath.Join(p, "b.tf")},
+		{filepath.Join(p, "c.tf"), filepath.Join(p, "d.tf")},
+	}, called, nil)
+
+	_, err = os.Stat(filepath.Join(p, "c.tf"))
+	assert.True(t, os.IsNotExist(err), nil)
+
+	assertNoTransactionLeftovers(t, p)
+}
+
+func assertNoTransactionLeftovers(t *testing.T, p string) {
+	files, err := os.ReadDir(p)
+	assert.Equal(t, nil, err, nil)
+
+	for _, f := range files {
+		assert.False(t, strings.HasSuffix(f.Name(), ".kbst-tmp"), f.Name())
+		assert.False(t, strings.HasSuffix(f.Name(), ".kbst-bak"), f.Name())
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	r := NewRootFS("/repo", NewMemFS(map[string][]byte{
+		"providers.tf.json": []byte(`{
+  "provider": {
+    "kustomization": [{"alias": "test_cluster"}]
+  }
+}`),
+		"variables.tf.json": []byte(`{
+  "variable": {
+    "test_var": {"default": "default"}
+  }
+}`),
+		"terraform.tfvars.json": []byte(`{"test_var": "from tfvars"}`),
+		"service.tf.json": []byte(`{
+  "module": {
+    "test_service": {
+      "providers": {"kustomization": "kustomization.test_cluster"},
+      "source": "kbst.xyz/catalog/test/kustomization",
+      "version": "0.0.0-test.0",
+      "configuration": {
+        "apps": {"test_attr": "test"},
+        "ops": {}
+      }
+    }
+  }
+}`),
+		"package.json": []byte(`{"name": "not terraform"}`),
+	}))
+	err := r.Read()
+	assert.Equal(t, nil, err, nil)
+
+	assert.Len(t, r.Variables["/repo/variables.tf.json"], 1, nil)
+	assert.Len(t, r.Providers["/repo/providers.tf.json"], 1, nil)
+	_, ok := r.Modules["/repo/package.json"]
+	assert.False(t, ok, nil)
+
+	mods := r.Modules["/repo/service.tf.json"]
+	assert.Len(t, mods, 1, nil)
+	assert.Equal(t, "test_service", mods[0].Name, nil)
+	assert.Equal(t, "0.0.0-test.0", mods[0].Version, nil)
+	assert.Equal(t, "test_cluster", mods[0].Providers["kustomization"].Alias, nil)
+	assert.Equal(t, "test", mods[0].Configuration["apps"]["test_attr"].AsString(), nil)
+
+	v, _ := r.GetVariableValue("test_var")
+	assert.Equal(t, "from tfvars", v.AsString(), nil)
+}
@@ -0,0 +1,137 @@
+package tfhcl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+)
+
+// transaction stages file writes and deletes so they can
+// be applied together and rolled back if any of them fails
+type transaction struct {
+	fsys FS
+	ops  []*fileOp
+}
+
+type fileOp struct {
+	path string
+
+	// name is the name of path in the transaction's FS
+	name string
+
+	// temp holds the staged content, empty for deletes
+	temp string
+
+	// backup holds the original file moved out of the way,
+	// empty if the file did not exist before
+	backup string
+
+	// placed is true once temp was renamed to path
+	placed bool
+}
+
+// stagedFiles counts the temporary files of this process
+// to keep their names unique
+var stagedFiles uint64
+
+// stagingName returns a name for a temporary file next to name
+func stagingName(name, suffix string) string {
+	n := atomic.AddUint64(&stagedFiles, 1)
+
+	return path.Join(path.Dir(name), fmt.Sprintf(".%s.%d-%d-%d.%s", path.Base(name), os.Getpid(), time.Now().UnixNano(), n, suffix))
+}
+
+func (tx *transaction) stageWrite(path, name string, data []byte, mode fs.FileMode) (err error) {
+	op := &fileOp{path: path, name: name, temp: stagingName(name, "kbst-tmp")}
+
+	tx.ops = append(tx.ops, op)
+
+	return tx.fsys.WriteFile(op.temp, data, mode)
+}
+
+func (tx *transaction) stageDelete(path, name string) {
+	for _, op := range tx.ops {
+		if op.path == path && op.temp == "" {
+			return
+		}
+	}
+
+	tx.ops = append(tx.ops, &fileOp{path: path, name: name})
+}
+
+func (tx *transaction) commit() (err error) {
+	for _, op := range tx.ops {
+		err = op.apply(tx.fsys)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	for _, op := range tx.ops {
+		if op.backup != "" {
+			tx.fsys.Remove(op.backup)
+		}
+	}
+
+	return nil
+}
+
+func (tx *transaction) rollback() {
+	for i := len(tx.ops) - 1; i >= 0; i-- {
+		op := tx.ops[i]
+
+		if op.temp != "" {
+			tx.fsys.Remove(op.temp)
+			op.temp = ""
+		}
+
+		if op.placed {
+			tx.fsys.Remove(op.name)
+			op.placed = false
+		}
+
+		if op.backup != "" {
+			tx.fsys.Rename(op.backup, op.name)
+			op.backup = ""
+		}
+	}
+}
+
+func (op *fileOp) apply(fsys FS) error {
+	_, err := fsys.Stat(op.name)
+	notExist := errors.Is(err, fs.ErrNotExist)
+	if err != nil && !notExist {
+		return err
+	}
+
+	if notExist && op.temp == "" {
+		return &fs.PathError{Op: "remove", Path: op.path, Err: fs.ErrNotExist}
+	}
+
+	if err == nil {
+		// move the original out of the way
+		// to be able to restore it on rollback
+		backup := stagingName(op.name, "kbst-bak")
+		err = fsys.Rename(op.name, backup)
+		if err != nil {
+			return err
+		}
+		op.backup = backup
+	}
+
+	if op.temp != "" {
+		err = fsys.Rename(op.temp, op.name)
+		if err != nil {
+			return err
+		}
+		op.temp = ""
+		op.placed = true
+	}
+
+	return nil
+}
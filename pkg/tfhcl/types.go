@@ -2,10 +2,12 @@ package tfhcl
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
 )
 
 type Blocks struct {
@@ -236,3 +238,77 @@ func (m *Module) ParentCluster() (string, error) {
 
 	return "", fmt.Errorf("no parent cluster found for %q", m.Name)
 }
+
+func (m *Module) References() []string {
+	exprs := []hcl.Expression{
+		m.ClusterNameRaw,
+		m.ClusterMetadataRaw,
+		m.MetadataFQDNRaw,
+		m.ConfigurationRaw,
+	}
+	exprs = append(exprs, bodyExpressions(m.Body)...)
+
+	return moduleReferences(exprs)
+}
+
+func (p *Provider) References() []string {
+	exprs := []hcl.Expression{
+		p.KubeconfigRaw,
+	}
+	exprs = append(exprs, bodyExpressions(p.Body)...)
+
+	return moduleReferences(exprs)
+}
+
+func (p *Provider) Address() string {
+	if p.Alias == "" {
+		return p.Name
+	}
+
+	return fmt.Sprintf("%s.%s", p.Name, p.Alias)
+}
+
+// moduleReferences returns the sorted names of all
+// modules referenced as module.<name> in exprs
+func moduleReferences(exprs []hcl.Expression) (refs []string) {
+	for _, e := range exprs {
+		if e == nil {
+			continue
+		}
+
+		for _, t := range e.Variables() {
+			spl := t.SimpleSplit()
+			if spl.RootName() != "module" || len(spl.Rel) == 0 {
+				continue
+			}
+
+			ta, ok := spl.Rel[0].(hcl.TraverseAttr)
+			if !ok {
+				continue
+			}
+
+			if !slices.Contains(refs, ta.Name) {
+				refs = append(refs, ta.Name)
+			}
+		}
+	}
+
+	sort.Strings(refs)
+
+	return refs
+}
+
+// bodyExpressions returns the expressions of all attributes
+// in a body, blocks inside the body are ignored
+func bodyExpressions(b hcl.Body) (exprs []hcl.Expression) {
+	if b == nil {
+		return exprs
+	}
+
+	attrs, _ := b.JustAttributes()
+	for _, a := range attrs {
+		exprs = append(exprs, a.Expr)
+	}
+
+	return exprs
+}
@@ -3,6 +3,9 @@ package tfhcl
 import (
 	"testing"
 
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -85,3 +88,35 @@ func TestTypeProviderVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestModuleReferences(t *testing.T) {
+	p := hclparse.NewParser()
+	f, _ := p.ParseHCL([]byte(`
+module "test_node_pool" {
+  source = "test_source"
+
+  cluster_name   = module.test_cluster.current_metadata["name"]
+  resource_group = module.test_group.current_config["resource_group"]
+
+  configuration = {
+    apps = {
+      location = module.test_cluster.current_config["region"]
+      name     = var.name
+    }
+  }
+}
+
+provider "kustomization" {
+  alias = "test_cluster"
+
+  kubeconfig_raw = module.test_cluster.kubeconfig
+}
+`), "test.tf")
+
+	var b Blocks
+	gohcl.DecodeBody(f.Body, &hcl.EvalContext{}, &b)
+
+	assert.Equal(t, []string{"test_cluster", "test_group"}, b.Modules[0].References())
+	assert.Equal(t, []string{"test_cluster"}, b.Providers[0].References())
+	assert.Equal(t, "kustomization.test_cluster", b.Providers[0].Address())
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/mod/semver"
+)
+
+// Channels are the release channels, from most to least
+// stable, each channel includes the more stable ones
+var Channels = []string{"stable", "beta", "dev"}
+
+// ValidateChannel returns an error if c is not a known channel
+func ValidateChannel(c string) error {
+	if !slices.Contains(Channels, c) {
+		return fmt.Errorf("invalid channel '%s', choose one of %v", c, Channels)
+	}
+
+	return nil
+}
+
+// ReleaseChannel returns the channel of v, set explicitly in
+// the cli.json or derived from the pre-release suffix, catalog
+// -kbst.N suffixes are packaging revisions of stable releases
+func (v Version) ReleaseChannel() string {
+	if v.Channel != "" {
+		return v.Channel
+	}
+
+	pr := strings.TrimPrefix(semver.Prerelease(CanonicalVersion(v.Name)), "-")
+	switch {
+	case pr == "" || strings.HasPrefix(pr, "kbst"):
+		return "stable"
+	case strings.HasPrefix(pr, "beta") || strings.HasPrefix(pr, "rc"):
+		return "beta"
+	}
+
+	return "dev"
+}
+
+// InChannel returns true if v is part of channel c
+func (v Version) InChannel(c string) bool {
+	return slices.Index(Channels, v.ReleaseChannel()) <= slices.Index(Channels, c)
+}
+
+// InChannel returns a copy of e with only
+// the versions that are part of channel c
+func (e Entry) InChannel(c string) Entry {
+	f := Entry{Name: e.Name}
+	for _, v := range e.Versions {
+		if v.InChannel(c) {
+			f.Versions = append(f.Versions, v)
+		}
+	}
+
+	return f
+}
+
+// SetChannel restricts the framework and catalog versions
+// to channel c, CLI versions are not restricted
+func (cj *CliJSON) SetChannel(c string) error {
+	err := ValidateChannel(c)
+	if err != nil {
+		return err
+	}
+
+	cj.Channel = c
+	cj.Framework = cj.Framework.InChannel(c)
+
+	catalog := map[string]Entry{}
+	for name, e := range cj.Catalog {
+		catalog[name] = e.InChannel(c)
+	}
+	cj.Catalog = catalog
+
+	return nil
+}
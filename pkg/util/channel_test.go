@@ -0,0 +1,63 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionReleaseChannel(t *testing.T) {
+	cases := map[string]string{
+		"v0.18.1":        "stable",
+		"1.3.2-kbst.0":   "stable",
+		"v0.18.1-beta.0": "beta",
+		"v1.0.0-rc.1":    "beta",
+		"v1.0.0-alpha.1": "dev",
+		"v1.0.0-dev.3":   "dev",
+	}
+
+	for name, expected := range cases {
+		assert.Equal(t, expected, Version{Name: name}.ReleaseChannel(), name)
+	}
+
+	v := Version{Name: "v0.18.1", Channel: "dev"}
+	assert.Equal(t, "dev", v.ReleaseChannel(), nil)
+	assert.False(t, v.InChannel("beta"), nil)
+	assert.True(t, v.InChannel("dev"), nil)
+}
+
+func TestCliJSONSetChannel(t *testing.T) {
+	cj := CliJSON{
+		Framework: Entry{
+			Name: "framework",
+			Versions: []Version{
+				{Name: "v0.19.0-alpha.0"},
+				{Name: "v0.18.1-beta.0"},
+				{Name: "v0.18.0"},
+			},
+		},
+		Catalog: map[string]Entry{
+			"nginx": {
+				Name: "nginx",
+				Versions: []Version{
+					{Name: "v1.3.2-kbst.0"},
+				},
+			},
+		},
+	}
+
+	err := cj.SetChannel("nightly")
+	assert.EqualError(t, err, "invalid channel 'nightly', choose one of [stable beta dev]", nil)
+
+	err = cj.SetChannel("beta")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, []Version{{Name: "v0.18.1-beta.0"}, {Name: "v0.18.0"}}, cj.Framework.Versions, nil)
+	assert.Len(t, cj.Catalog["nginx"].Versions, 1, nil)
+
+	err = cj.SetChannel("stable")
+	assert.Equal(t, nil, err, nil)
+
+	v, err := cj.Framework.GetReleaseOrLatest("latest")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, "v0.18.0", v.Name, nil)
+}
@@ -10,6 +10,13 @@ type Version struct {
 	Name     string            `json:"name"`
 	Archive  string            `json:"archive,omitempty"`
 	Archives map[string]string `json:"archives,omitempty"`
+
+	// Required versions can not be skipped when upgrading
+	Required bool `json:"required,omitempty"`
+
+	// Channel is stable, beta or dev, if empty
+	// it is derived from the pre-release suffix
+	Channel string `json:"channel,omitempty"`
 }
 
 type Entry struct {
@@ -17,32 +24,42 @@ type Entry struct {
 	Versions []Version `json:"versions"`
 }
 
+// GetReleaseOrLatest returns the newest version for "latest",
+// the version named r or the newest version matching the
+// constraint r, e.g. "~> 0.18" or ">= 0.17, < 0.19"
 func (e Entry) GetReleaseOrLatest(r string) (v Version, err error) {
 	if len(e.Versions) < 1 {
 		return v, fmt.Errorf("no versions for '%s'", e.Name)
 	}
 
-	v = e.Versions[0]
-	if r != "latest" {
-		var cv Version
-		for i := range e.Versions {
-			cv = e.Versions[i]
-			if cv.Name == r {
-				v = cv
-				break
-			}
+	latest, ok := e.Latest()
+	if !ok {
+		latest = e.Versions[0]
+	}
+
+	if r == "latest" {
+		return latest, nil
+	}
+
+	for _, cv := range e.Versions {
+		if cv.Name == r {
+			return cv, nil
 		}
+	}
 
-		if cv.Name != r {
-			return Version{}, fmt.Errorf(
-				"'%s' is not a valid version, try the latest version '%s'",
-				r,
-				v.Name,
-			)
+	c, err := ParseConstraint(r)
+	if err == nil {
+		v, ok = e.Resolve(c)
+		if ok {
+			return v, nil
 		}
 	}
 
-	return v, nil
+	return Version{}, fmt.Errorf(
+		"'%s' is not a valid version, try the latest version '%s'",
+		r,
+		latest.Name,
+	)
 }
 
 type CliJSON struct {
@@ -50,6 +67,10 @@ type CliJSON struct {
 	Framework Entry            `json:"framework"`
 	Cli       Entry            `json:"cli"`
 	CloudInfo CloudInfo
+
+	// Channel restricts the framework and catalog
+	// versions Load keeps, empty keeps all versions
+	Channel string `json:"-"`
 }
 
 func (cj *CliJSON) Load(d Downloader) (err error) {
@@ -66,6 +87,13 @@ func (cj *CliJSON) Load(d Downloader) (err error) {
 
 	json.Unmarshal([]byte(respJson), &cj)
 
+	if cj.Channel != "" {
+		err = cj.SetChannel(cj.Channel)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = cj.CloudInfo.Load(d)
 	if err != nil {
 		return err
@@ -0,0 +1,223 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+var constraintOperators = []string{"~>", ">=", "<=", "!=", ">", "<", "="}
+
+// Constraint is a comma separated list of version
+// conditions that all have to match, e.g. ">= 0.17, < 0.19"
+type Constraint []condition
+
+type condition struct {
+	op      string
+	version string
+
+	// parts is the number of version parts specified,
+	// "~> 0.18" allows newer minor, "~> 0.18.1" newer
+	// patch versions only
+	parts int
+}
+
+// ParseConstraint parses c, conditions are one of the operators
+// =, !=, >, >=, <, <= or ~> followed by a version with or without
+// "v" prefix, a version without operator must match exactly
+func ParseConstraint(c string) (Constraint, error) {
+	con := Constraint{}
+
+	for _, s := range strings.Split(c, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return con, fmt.Errorf("invalid version constraint '%s'", c)
+		}
+
+		cond := condition{op: "="}
+		for _, op := range constraintOperators {
+			if strings.HasPrefix(s, op) {
+				cond.op = op
+				s = strings.TrimSpace(strings.TrimPrefix(s, op))
+				break
+			}
+		}
+
+		cond.version = CanonicalVersion(s)
+		if !semver.IsValid(cond.version) {
+			return con, fmt.Errorf("invalid version '%s' in constraint '%s'", s, c)
+		}
+
+		core := strings.SplitN(strings.TrimPrefix(s, "v"), "-", 2)[0]
+		core = strings.SplitN(core, "+", 2)[0]
+		cond.parts = len(strings.Split(core, "."))
+
+		cond.version = semver.Canonical(cond.version)
+
+		con = append(con, cond)
+	}
+
+	return con, nil
+}
+
+// Check returns true if v matches all conditions
+func (c Constraint) Check(v string) bool {
+	v = CanonicalVersion(v)
+	if !semver.IsValid(v) {
+		return false
+	}
+
+	for _, cond := range c {
+		if !cond.check(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasPrerelease returns true if any condition
+// specifies a pre-release version
+func (c Constraint) hasPrerelease() bool {
+	for _, cond := range c {
+		if isPrerelease(cond.version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cond condition) check(v string) bool {
+	// catalog -kbst.N revisions compare like the release
+	// they package, unless the condition specifies one
+	if !isRevision(cond.version) && isRevision(v) {
+		v = VersionCore(v)
+	}
+
+	// lower bounds compare the full version, so pre-releases
+	// of the bound itself do not match, upper bounds compare
+	// the version core, so pre-releases of an excluded upper
+	// bound do not match either
+	full := semver.Compare(v, cond.version)
+	core := full
+	if semver.Prerelease(cond.version) == "" {
+		core = semver.Compare(VersionCore(v), cond.version)
+	}
+
+	switch cond.op {
+	case "=":
+		return full == 0
+	case "!=":
+		return full != 0
+	case ">":
+		return full > 0
+	case ">=":
+		return full >= 0
+	case "<":
+		return core < 0
+	case "<=":
+		return core <= 0
+	case "~>":
+		return full >= 0 && semver.Compare(VersionCore(v), cond.upperBound()) < 0
+	}
+
+	return false
+}
+
+// upperBound returns the exclusive upper bound of ~>,
+// the next minor for three, the next major for fewer parts
+func (cond condition) upperBound() string {
+	mm := strings.Split(strings.TrimPrefix(semver.MajorMinor(cond.version), "v"), ".")
+
+	var major, minor int
+	fmt.Sscanf(mm[0], "%d", &major)
+	fmt.Sscanf(mm[1], "%d", &minor)
+
+	if cond.parts >= 3 {
+		return fmt.Sprintf("v%d.%d.0", major, minor+1)
+	}
+
+	return fmt.Sprintf("v%d.0.0", major+1)
+}
+
+// Resolve returns the newest version matching constraint c,
+// pre-releases only match if no stable version does or if c
+// specifies a pre-release itself
+func (e Entry) Resolve(c Constraint) (v Version, ok bool) {
+	var stable, any *Version
+	for i := range e.Versions {
+		cv := &e.Versions[i]
+		if !c.Check(cv.Name) {
+			continue
+		}
+
+		if any == nil || semver.Compare(CanonicalVersion(cv.Name), CanonicalVersion(any.Name)) > 0 {
+			any = cv
+		}
+
+		if isPrerelease(CanonicalVersion(cv.Name)) {
+			continue
+		}
+
+		if stable == nil || semver.Compare(CanonicalVersion(cv.Name), CanonicalVersion(stable.Name)) > 0 {
+			stable = cv
+		}
+	}
+
+	if stable != nil && !c.hasPrerelease() {
+		return *stable, true
+	}
+
+	if any != nil {
+		return *any, true
+	}
+
+	return v, false
+}
+
+// Latest returns the newest version, versions
+// that are not valid semver are ignored
+func (e Entry) Latest() (v Version, ok bool) {
+	for i, cv := range e.Versions {
+		if !semver.IsValid(CanonicalVersion(cv.Name)) {
+			continue
+		}
+
+		if !ok || semver.Compare(CanonicalVersion(cv.Name), CanonicalVersion(v.Name)) > 0 {
+			v = e.Versions[i]
+			ok = true
+		}
+	}
+
+	return v, ok
+}
+
+// CanonicalVersion prefixes v with "v" if it is missing,
+// catalog module versions are specified without it
+func CanonicalVersion(v string) string {
+	if strings.HasPrefix(v, "v") {
+		return v
+	}
+
+	return fmt.Sprintf("v%s", v)
+}
+
+// VersionCore returns v without prerelease and build suffixes
+func VersionCore(v string) string {
+	c := semver.Canonical(v)
+	return strings.TrimSuffix(c, semver.Prerelease(c))
+}
+
+// isRevision returns true if v has a catalog -kbst.N suffix,
+// a packaging revision of the stable release v
+func isRevision(v string) bool {
+	return strings.HasPrefix(semver.Prerelease(v), "-kbst")
+}
+
+// isPrerelease returns true if v has a pre-release
+// suffix that is not a catalog packaging revision
+func isPrerelease(v string) bool {
+	return semver.Prerelease(v) != "" && !isRevision(v)
+}
@@ -0,0 +1,150 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testConstraintEntry = Entry{
+	Name: "test",
+	Versions: []Version{
+		{Name: "v0.19.0-beta.0"},
+		{Name: "v0.18.2-beta.0"},
+		{Name: "v0.18.1"},
+		{Name: "v0.18.0"},
+		{Name: "v0.17.1"},
+		{Name: "v1.0.0-rc.1"},
+	},
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, c := range []string{"", "~>", ">= 0.17,", ">= x.y", "=> 0.17"} {
+		_, err := ParseConstraint(c)
+		assert.Error(t, err, c)
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{"0.18.1", "v0.18.1", true},
+		{"v0.18.1", "0.18.1", true},
+		{"= 0.18.1", "v0.18.1-beta.0", false},
+		{"!= 0.18.1", "v0.18.0", true},
+		{">= 0.17, < 0.19", "v0.18.2-beta.0", true},
+		{">= 0.17, < 0.19", "v0.19.0-beta.0", false},
+		{">= 0.18.0", "v0.18.0-beta.0", false},
+		{"> 0.18.0-beta.0", "v0.18.0", true},
+		{"<= 0.18", "v0.18.0", true},
+		{"~> 0.18", "v0.99.0", true},
+		{"~> 0.18", "v1.0.0-rc.1", false},
+		{"~> 0.18.1", "v0.18.9", true},
+		{"~> 0.18.1", "v0.19.0", false},
+		{"~> 0.18.1", "v0.18.0", false},
+		{"~> 0.18", "not-a-version", false},
+		// catalog revisions are stable releases of their version core
+		{">= 1.10.0", "v1.10.0-kbst.1", true},
+		{"> 1.10.0", "v1.10.0-kbst.1", false},
+		{"< 1.10.0", "v1.10.0-kbst.1", false},
+		{"<= 1.10.0", "v1.10.0-kbst.1", true},
+		{"= 1.3.1", "v1.3.1-kbst.0", true},
+		{"~> 1.3.1", "v1.3.1-kbst.0", true},
+		{"~> 1.3.1", "v1.4.0-kbst.0", false},
+		{"= 1.3.1-kbst.0", "v1.3.1-kbst.1", false},
+		{"> 1.3.1-kbst.0", "v1.3.1-kbst.1", true},
+	}
+
+	for _, tc := range cases {
+		c, err := ParseConstraint(tc.constraint)
+		assert.Equal(t, nil, err, tc.constraint)
+		assert.Equal(t, tc.expected, c.Check(tc.version), "%s %s", tc.constraint, tc.version)
+	}
+}
+
+func TestEntryResolve(t *testing.T) {
+	cases := []struct {
+		constraint string
+		expected   string
+	}{
+		// stable versions are preferred
+		{"~> 0.18.0", "v0.18.1"},
+		// pre-releases match, if the constraint specifies one
+		{">= 0.18.2-beta.0, < 0.19", "v0.18.2-beta.0"},
+		// or if no stable version matches
+		{"> 0.18.1, < 0.19", "v0.18.2-beta.0"},
+		{"< 0.18", "v0.17.1"},
+	}
+
+	for _, tc := range cases {
+		c, err := ParseConstraint(tc.constraint)
+		assert.Equal(t, nil, err, tc.constraint)
+
+		v, ok := testConstraintEntry.Resolve(c)
+		assert.True(t, ok, tc.constraint)
+		assert.Equal(t, tc.expected, v.Name, tc.constraint)
+	}
+
+	c, _ := ParseConstraint("> 2.0")
+	_, ok := testConstraintEntry.Resolve(c)
+	assert.False(t, ok, nil)
+}
+
+func TestEntryResolveRevisions(t *testing.T) {
+	e := Entry{
+		Name: "cert-manager",
+		Versions: []Version{
+			{Name: "v1.11.0-beta.0"},
+			{Name: "v1.10.0-kbst.1"},
+			{Name: "v1.10.0-kbst.0"},
+			{Name: "v1.3.1-kbst.0"},
+		},
+	}
+
+	cases := []struct {
+		constraint string
+		expected   string
+	}{
+		// revisions are preferred over pre-releases
+		{">= 1.10.0", "v1.10.0-kbst.1"},
+		{"~> 1.3.1", "v1.3.1-kbst.0"},
+		{"1.10.0", "v1.10.0-kbst.1"},
+		{"1.10.0-kbst.0", "v1.10.0-kbst.0"},
+		{"> 1.10.0", "v1.11.0-beta.0"},
+	}
+
+	for _, tc := range cases {
+		c, err := ParseConstraint(tc.constraint)
+		assert.Equal(t, nil, err, tc.constraint)
+
+		v, ok := e.Resolve(c)
+		assert.True(t, ok, tc.constraint)
+		assert.Equal(t, tc.expected, v.Name, tc.constraint)
+	}
+
+	v, err := e.GetReleaseOrLatest(">= 1.10.0")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, "v1.10.0-kbst.1", v.Name, nil)
+}
+
+func TestEntryLatest(t *testing.T) {
+	v, ok := testConstraintEntry.Latest()
+	assert.True(t, ok, nil)
+	assert.Equal(t, "v1.0.0-rc.1", v.Name, nil)
+}
+
+func TestGetReleaseOrLatestConstraint(t *testing.T) {
+	v, err := testConstraintEntry.GetReleaseOrLatest("~> 0.17.0")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, "v0.17.1", v.Name, nil)
+
+	v, err = testConstraintEntry.GetReleaseOrLatest("0.18.0")
+	assert.Equal(t, nil, err, nil)
+	assert.Equal(t, "v0.18.0", v.Name, nil)
+
+	_, err = testConstraintEntry.GetReleaseOrLatest(">= 2.0")
+	assert.EqualError(t, err, "'>= 2.0' is not a valid version, try the latest version 'v1.0.0-rc.1'", nil)
+}